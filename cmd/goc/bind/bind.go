@@ -13,6 +13,9 @@ import (
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/gopherc/goc/cmd/goc/config"
+	"github.com/gopherc/goc/cmd/goc/watch"
 )
 
 type TypeSpec struct {
@@ -40,7 +43,10 @@ type FuncBinding struct {
 var allTypes = map[string]TypeSpec{}
 
 func Bind() int {
-	setupFlags()
+	if err := setupFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
 	inputPaths := flag.Args()
 	if len(inputPaths) < 1 {
 		fmt.Fprintln(os.Stderr, "no source")
@@ -52,8 +58,23 @@ func Bind() int {
 		output = filepath.Join(inputPaths[0], "bind_goc.c")
 	}
 
-	if err := Generate(inputPaths[0], output); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	generate := func() bool {
+		if err := Generate(inputPaths[0], output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		return true
+	}
+
+	if watchMode {
+		ctx, stop := watch.Interrupted()
+		defer stop()
+		return watch.Run(ctx, "bind", inputPaths[:1], watch.Bindings, func([]string) bool {
+			return generate()
+		})
+	}
+
+	if !generate() {
 		return -1
 	}
 	return 0
@@ -82,7 +103,7 @@ func Generate(projectPath, outputFile string) error {
 			if err != nil {
 				return err
 			}
-			pkgPath = filepath.Join(moduleName, pkgPath)
+			pkgPath = filepath.Join(ModuleName, pkgPath)
 
 			if info.Name() == "goc.type" {
 				fp, err := os.Open(path)
@@ -151,6 +172,14 @@ func Generate(projectPath, outputFile string) error {
 		fmt.Fprint(fpc, "\n")
 	}
 
+	// The exports of the module are prefixed with WASM_RT_MODULE_PREFIX, see goc-rt.c.
+	fmt.Fprint(fpc, "#ifndef WASM_RT_MODULE_PREFIX\n#define WASM_RT_MODULE_PREFIX\n#endif\n")
+	fmt.Fprint(fpc, "#define WASM_RT_PASTE_(x, y) x ## y\n")
+	fmt.Fprint(fpc, "#define WASM_RT_PASTE(x, y) WASM_RT_PASTE_(x, y)\n")
+	fmt.Fprint(fpc, "#define WASM_RT_ADD_PREFIX(x) WASM_RT_PASTE(WASM_RT_MODULE_PREFIX, x)\n")
+	fmt.Fprint(fpc, "#define Z_getspZ_iv WASM_RT_ADD_PREFIX(Z_getspZ_iv)\n")
+	fmt.Fprint(fpc, "#define Z_mem WASM_RT_ADD_PREFIX(Z_mem)\n\n")
+
 	fmt.Fprint(fpc, "extern uint32_t (*Z_getspZ_iv)();\n")
 	fmt.Fprint(fpc, "extern wasm_rt_memory_t *Z_mem;\n\n")
 
@@ -165,7 +194,7 @@ func Generate(projectPath, outputFile string) error {
 			if err != nil {
 				return err
 			}
-			pkgPath = filepath.Join(moduleName, pkgPath)
+			pkgPath = filepath.Join(ModuleName, pkgPath)
 
 			if info.Name() == "goc.bind" {
 				fp, err := os.Open(path)
@@ -549,25 +578,32 @@ func About() string {
 }
 
 var (
-	moduleName = "github.com/user/mod"
+	ModuleName = "github.com/user/mod"
 	buildTags  = "goc"
+	profile    = os.Getenv("GOCPROFILE")
 	goPrefix,
 	goImport,
 	cBindFile string
 
 	Silent,
-	Verbose bool
+	Verbose,
+	watchMode bool
 )
 
-func setupFlags() {
-	flag.StringVar(&moduleName, "m", moduleName, "module name")
+func setupFlags() error {
+	flag.StringVar(&ModuleName, "m", ModuleName, "module name")
 	flag.StringVar(&cBindFile, "o", cBindFile, "resulting C binding file")
 	flag.StringVar(&buildTags, "tags", buildTags, "build tags")
 	flag.StringVar(&goPrefix, "prefix", goPrefix, "inject Go default prefix")
 	flag.StringVar(&goImport, "import", goImport, "default imports")
 	flag.BoolVar(&Silent, "s", Silent, "silent mode")
 	flag.BoolVar(&Verbose, "v", Verbose, "verbose")
+	flag.BoolVar(&watchMode, "watch", watchMode, "regenerate the bindings when goc.bind or goc.type files change")
+	flag.StringVar(&profile, "profile", profile, "select a profile from the project goc.json (GOCPROFILE)")
 	flag.Parse()
+
+	_, err := config.Apply("bind", profile)
+	return err
 }
 
 func PrintDefaults() {
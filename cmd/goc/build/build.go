@@ -4,10 +4,12 @@
 package build
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,79 +18,324 @@ import (
 	"time"
 
 	"github.com/gopherc/goc/cmd/goc/bind"
+	"github.com/gopherc/goc/cmd/goc/cache"
+	"github.com/gopherc/goc/cmd/goc/config"
+	"github.com/gopherc/goc/cmd/goc/wasm2c"
+	"github.com/gopherc/goc/cmd/goc/watch"
 )
 
 func Build() int {
 	buildStart := time.Now()
 
-	setupFlags()
-	inputFiles := flag.Args()
-	if len(inputFiles) < 1 {
+	if err := setupFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	inputs := flag.Args()
+	if len(inputs) < 1 && Test {
+		inputs = []string{"."}
+	} else if len(inputs) < 1 {
 		fmt.Fprintln(os.Stderr, "no input")
 		return -1
 	}
 
+	if translator != "wabt" && translator != "native" {
+		fmt.Fprintln(os.Stderr, "invalid translator:", translator)
+		return -1
+	}
+	if debugInfo && translator != "native" {
+		fmt.Fprintln(os.Stderr, "-debug requires the native translator")
+		return -1
+	}
+	if jobs < 1 {
+		fmt.Fprintln(os.Stderr, "invalid number of jobs:", jobs)
+		return -1
+	}
+	if dataMode != "auto" && dataMode != "array" && dataMode != "incbin" {
+		fmt.Fprintln(os.Stderr, "invalid data mode:", dataMode)
+		return -1
+	}
+	if dataMode == "incbin" && translator != "native" {
+		fmt.Fprintln(os.Stderr, "-data incbin requires the native translator")
+		return -1
+	}
+	if watchMode && DisableWatch {
+		fmt.Fprintln(os.Stderr, "-watch is only supported by goc build")
+		return -1
+	}
+
 	os.Setenv("GOOS", "js")
 	os.Setenv("GOARCH", "wasm")
 	os.Setenv("GOROOT", goRoot)
 
+	stop := handleInterrupt()
+	defer stop()
+	cancel := withTimeout()
+	defer cancel()
+
 	if workPath == "" {
-		workPath = os.TempDir()
-		defer os.RemoveAll(workPath)
+		// Every build gets its own work directory so concurrent builds do not collide.
+		path, err := ioutil.TempDir("", "goc-build")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
+		workPath = path
+		if !keepWork {
+			defer os.RemoveAll(workPath)
+		}
 	}
 
 	workPath, _ = filepath.Abs(workPath)
 	os.MkdirAll(workPath, 0755)
+	if keepWork {
+		fmt.Fprintln(os.Stderr, "WORK="+workPath)
+	}
+
+	if len(buildTags) > 0 && !strings.HasPrefix(buildTags, " ") {
+		buildTags = " " + buildTags
+	}
+
+	goFlags, err := goBuildFlags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	pkgs, err := resolvePackages(inputs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	if err := setupTarget(pkgs[0].root()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	if err := setupCLink(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	outputs, err := packageOutputs(pkgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	if watchMode {
+		var roots []string
+		for _, pkg := range pkgs {
+			roots = append(roots, pkg.root())
+		}
+
+		return watch.Run(interrupted, "build", roots, watch.Sources, func(changed []string) bool {
+			// The timeout applies to each build.
+			cancel := withTimeout()
+			defer cancel()
+
+			// The bindings in the work directory are still valid if no binding files changed.
+			reuseBindings = changed != nil
+			for _, file := range changed {
+				reuseBindings = reuseBindings && !watch.Bindings(filepath.Base(file))
+			}
 
+			ret := buildPackages(pkgs, outputs, goFlags)
+			return ret == 0 || ret == NoOutput
+		})
+	}
+
+	ret := buildPackages(pkgs, outputs, goFlags)
+	if err := cache.Trim(cache.MaxAge, false); err != nil {
+		logvln("Could not trim the cache:", err)
+	}
+	logln("Build time:", time.Since(buildStart).Round(time.Second))
+	return ret
+}
+
+// buildPackages builds each package to its output, it stops at the first
+// failure unless testing. The status of the first failure is returned.
+func buildPackages(pkgs []*goPackage, outputs []string, goFlags []string) int {
+	ret, failed := 0, 0
+	rootWorkPath, defaultBindingsPath := workPath, bindingsPath
+	defer func() {
+		workPath, bindingsPath = rootWorkPath, defaultBindingsPath
+	}()
+
+	for i, pkg := range pkgs {
+		outputName, bindingsPath = outputs[i], defaultBindingsPath
+		if len(pkgs) > 1 {
+			logln("Package:", pkg.ImportPath)
+			workPath = filepath.Join(rootWorkPath, fmt.Sprint(i))
+			os.MkdirAll(workPath, 0755)
+		}
+
+		currentPackage = pkg.ImportPath
+		pkgStart := time.Now()
+		ret = buildPackage(pkg, goFlags)
+		reportPackage(pkgStart, ret)
+		if Built != nil {
+			Built(pkg.ImportPath, pkg.Dir, outputName, ret)
+		}
+
+		if ret != 0 && ret != NoOutput {
+			if !Test || cancelled() != nil {
+				return ret
+			}
+			if failed == 0 {
+				failed = ret
+			}
+		}
+	}
+	if failed != 0 {
+		return failed
+	}
+	return ret
+}
+
+func buildPackage(pkg *goPackage, goFlags []string) int {
 	tempWASMOutput := filepath.Join(workPath, "out.wasm")
 	args := []string{
 		"build",
 		"-o", tempWASMOutput,
 	}
-
-	if len(buildTags) > 0 && !strings.HasPrefix(buildTags, " ") {
-		buildTags = " " + buildTags
+	if Test {
+		args = []string{"test", "-c", "-o", tempWASMOutput}
 	}
+
+	args = append(args, goFlags...)
 	args = append(args, "-tags", "goc"+buildTags)
+	if len(pkg.Files) > 0 {
+		args = append(args, pkg.Files...)
+	} else {
+		args = append(args, ".")
+	}
 
-	inputFile, _ := filepath.Abs(inputFiles[0])
-	inputPath := filepath.Dir(inputFile)
-	args = append(args, inputFile)
+	inputPath := pkg.root()
 
 	tempBindOutput := filepath.Join(workPath, "bind_goc.c")
-	if generateCBindings {
+	if _, err := os.Stat(tempBindOutput); generateCBindings && reuseBindings && err == nil {
+		logvln("Using previous C bindings:", tempBindOutput)
+	} else if generateCBindings {
 		logln("Generating C bindings...")
+		st := beginStage("bindings", tempBindOutput)
 		bind.Silent = silent
 		bind.Verbose = verbose
+		if pkg.ModulePath != "" {
+			bind.ModuleName = pkg.ModulePath
+		}
 
 		if err := bind.Generate(inputPath, tempBindOutput); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return -1
+			return st.fail(err)
 		}
+		st.done(tempBindOutput)
 	}
 
 	logln("Building Go code...")
+	st := beginStage("go build", tempWASMOutput)
+	os.Remove(tempWASMOutput)
 	goBin := filepath.Join(goRoot, "bin", "go")
-	if err := runProgram(goBin, inputPath, args...); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return -1
+	if err := runProgram(goBin, pkg.Dir, args...); err != nil {
+		return st.fail(err)
+	}
+	st.done(tempWASMOutput)
+
+	if _, err := os.Stat(tempWASMOutput); os.IsNotExist(err) {
+		// go test -c does not produce any output for packages without tests.
+		return NoOutput
+	}
+
+	if deadCodeElimination {
+		logln("Removing dead code...")
+		dceOutput := filepath.Join(workPath, "out.dce.wasm")
+		dceReport := filepath.Join(workPath, "dce.txt")
+		st = beginStage("dce", dceOutput, dceReport)
+
+		report, err := eliminateDeadCode(tempWASMOutput, dceOutput, dceReport)
+		if err == nil {
+			err = cancelled()
+		}
+		if err != nil {
+			return st.fail(err)
+		}
+		logln(dceSummary(report))
+		for _, name := range report.Removed {
+			logvln("\t" + name)
+		}
+
+		st.done(dceOutput, dceReport)
+		tempWASMOutput = dceOutput
 	}
 
 	logln("Generating C code...")
+	st = beginStage("wasm2c")
 	tempCOutput := "out.c"
 	wasm2cBin := filepath.Join(wabtPath, "wasm2c")
-	if err := runProgram(wasm2cBin, workPath, tempWASMOutput, "-o", tempCOutput); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return -1
+
+	wasm2cHash := cache.NewHash("wasm2c")
+	if err := wasm2cHash.File(tempWASMOutput); err != nil {
+		return st.fail(err)
+	}
+	opt := wasm2c.Options{Debug: debugInfo}
+	cOutputs := []string{"out.c", "out.h"}
+	if useIncbin() {
+		opt.Data = wasm2c.DataIncbin
+		cOutputs = append(cOutputs, "out.data")
+	}
+
+	// The native translator splits the code into one translation unit per job.
+	var cUnits []string
+	if translator == "native" && buildmode != "c-source" && jobs > 1 {
+		opt.Units, opt.Prefix = jobs, symbolPrefix()
+		for _, file := range wasm2c.UnitFiles("out.c", jobs) {
+			cOutputs = append(cOutputs, file)
+			if strings.HasSuffix(file, ".c") {
+				cUnits = append(cUnits, filepath.Join(workPath, file))
+			}
+		}
+	}
+
+	if translator == "native" {
+		wasm2cHash.String(fmt.Sprintf("native %s debug=%v data=%d units=%d prefix=%s", wasm2c.Version, debugInfo, opt.Data, opt.Units, opt.Prefix))
+	} else if err := wasm2cHash.File(wasm2cBin); err != nil {
+		return st.fail(err)
+	}
+	wasm2cKey := wasm2cHash.Sum()
+
+	var artifacts []string
+	cached := !forceBuild
+	for _, name := range cOutputs {
+		file := filepath.Join(workPath, name)
+		artifacts = append(artifacts, file)
+		cached = cached && cache.Get(wasm2cKey, name, file)
+	}
+	st.outputs = artifacts
+
+	if cached {
+		logvln("Using cached C code:", wasm2cKey)
+		st.cached = true
+	} else {
+		if translator == "native" {
+			logvln("Translating", tempWASMOutput)
+			if err := wasm2c.TranslateFile(tempWASMOutput, filepath.Join(workPath, tempCOutput), opt); err != nil {
+				return st.fail(err)
+			}
+		} else if err := runProgram(wasm2cBin, workPath, tempWASMOutput, "-o", tempCOutput); err != nil {
+			return st.fail(err)
+		}
+		if err := cancelled(); err != nil {
+			return st.fail(err)
+		}
+		putCache(wasm2cKey, workPath, cOutputs...)
 	}
+	st.done(artifacts...)
 
 	// Give C compiler absolute path.
 	tempCOutput = filepath.Join(workPath, tempCOutput)
 
-	cFiles := []string{
-		tempCOutput,
-		filepath.Join(runtimePath, "goc-rt.c"),
-	}
+	cFiles := append([]string{tempCOutput}, cUnits...)
+	cFiles = append(cFiles, filepath.Join(runtimePath, "goc-rt.c"))
 
 	if bindingsPath == "" {
 		bindingsPath = inputPath
@@ -115,77 +362,92 @@ func Build() int {
 			foundHelper = true
 		}
 	}
+	cFiles = append(cFiles, extraCFiles...)
+
+	stageName := "C compile"
+	if buildmode == "c-source" {
+		stageName = "C source"
+	}
 
+	st = beginStage(stageName)
 	switch buildmode {
 	case "exe", "shared":
-		var cArgs, cTailArgs []string
-		baseName := strings.TrimSuffix(strings.ToLower(filepath.Base(cCompiler)), ".exe")
+		logln("Selected C compiler:", cCompiler)
 
-		if baseName == "cl" {
-			cArgs = []string{"/nologo", "/DGOC_ENTRY=" + entryName, "/Fe" + outputName, "/I" + runtimePath, "/I", workPath}
-			if buildmode == "shared" {
-				cArgs = append(cArgs, "/LD")
-			}
-		} else {
-			cArgs = []string{"-std=c99", "-DGOC_ENTRY=" + entryName, "-o", outputName, "-I", runtimePath, "-I", workPath}
-			if buildmode == "shared" {
-				cArgs = append(cArgs, "-shared")
-			}
-			if !strings.Contains(baseName, "clang") {
-				// Assume this is GCC.
-				cTailArgs = []string{"-lm"}
-			}
+		keyArgs := append(append(append(compileFlags(), linkOutputFlags(outputName)...), cFiles...), linkFlags()...)
+		compileKey, err := compileCacheKey(keyArgs, cFiles)
+		if err != nil {
+			return st.fail(err)
 		}
 
-		if cFlags != "" {
-			for _, a := range strings.Split(cFlags, " ") {
-				cArgs = append(cArgs, a)
+		output := st.tempOutput(outputName)
+		if !forceBuild && cache.Get(compileKey, "output", output) {
+			logln("Using cached C build:", compileKey)
+			st.cached = true
+		} else {
+			logln("Compiling C code...")
+			if err := linkExecutable(cFiles, output); err != nil {
+				return st.fail(err)
 			}
+			putCacheFile(compileKey, "output", output)
 		}
 
-		logln("Selected C compiler:", cCompiler)
+		files, err := st.commit()
+		if err != nil {
+			return st.fail(err)
+		}
+		st.done(files...)
+	case "static":
+		if err := buildStatic(st, cFiles); err != nil {
+			return st.fail(err)
+		}
 
-		logln("Compiling C code...")
-		finalArgs := append(append(cArgs, cFiles...), cTailArgs...)
-		if err := runProgram(cCompiler, "", finalArgs...); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return -1
+		files, err := st.commit()
+		if err != nil {
+			return st.fail(err)
 		}
+		st.done(files...)
 	case "c-source":
+		if err := checkSourceNames(cFiles); err != nil {
+			return st.fail(err)
+		}
 		if err := os.MkdirAll(outputName, 0755); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return -1
+			return st.fail(err)
 		}
 
-		if err := copyFiles(outputName, workPath, "*.c *.h"); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return -1
+		if err := copyFiles(outputName, workPath, "*.c *.h *.data"); err != nil {
+			return st.fail(err)
 		}
 
 		if err := copyFiles(outputName, runtimePath, "*.c *.h"); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return -1
+			return st.fail(err)
 		}
 
 		if foundBindings {
-			if err := copyFiles(outputName, inputPath, "bind_goc.c"); err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return -1
+			if err := copyFiles(outputName, bindingsPath, "bind_goc.c"); err != nil {
+				return st.fail(err)
 			}
 		}
 
 		if foundHelper {
-			if err := copyFiles(outputName, inputPath, "helper_goc.c"); err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return -1
+			if err := copyFiles(outputName, bindingsPath, "helper_goc.c"); err != nil {
+				return st.fail(err)
+			}
+		}
+
+		for _, file := range extraCFiles {
+			if err := copyFiles(outputName, filepath.Dir(file), filepath.Base(file)); err != nil {
+				return st.fail(err)
 			}
 		}
+
+		if err := writeBuildFiles(outputName, cFiles); err != nil {
+			return st.fail(err)
+		}
+		st.done(outputName)
 	default:
-		fmt.Fprintln(os.Stderr, "invalid buildmode:", buildmode)
-		return -1
+		return st.fail(fmt.Errorf("invalid buildmode: %s", buildmode))
 	}
-
-	logln("Build time:", time.Since(buildStart).Round(time.Second))
 	return 0
 }
 
@@ -196,10 +458,28 @@ func runProgram(prog, cwd string, args ...string) error {
 	}
 	logvln(print...)
 
+	var stdout, stderr bytes.Buffer
 	cmd := exec.Command(prog, args...)
 	cmd.Dir = cwd
-	if output, err := cmd.CombinedOutput(); err != nil {
-		str := strings.TrimSpace(string(output))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := runCommand(cmd)
+
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		exitCode = -1
+	}
+	reportCommand(prog, cwd, args, start, exitCode, stderr.String())
+
+	if cerr := cancelled(); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		str := strings.TrimSpace(stdout.String() + stderr.String())
 		if len(str) > 0 {
 			return errors.New(str)
 		}
@@ -208,6 +488,146 @@ func runProgram(prog, cwd string, args ...string) error {
 	return nil
 }
 
+func putCache(key, path string, names ...string) {
+	for _, name := range names {
+		putCacheFile(key, name, filepath.Join(path, name))
+	}
+}
+
+func putCacheFile(key, name, file string) {
+	if err := cache.Put(key, name, file); err != nil {
+		logvln("Could not cache", name+":", err)
+	}
+}
+
+// compileCacheKey hashes everything that affects the C compile: the compiler
+// identity, the full argument list, the C sources and the headers they include.
+func compileCacheKey(args, cFiles []string) (string, error) {
+	h := cache.NewHash("cc")
+	h.String(compilerID())
+	h.String(buildmode)
+	for _, a := range args {
+		// The work path and output name must not affect the key.
+		switch a {
+		case outputName:
+			a = "$OUT"
+		case "/Fe" + outputName:
+			a = "/Fe$OUT"
+		default:
+			a = strings.Replace(a, workPath, "$WORK", -1)
+		}
+		h.String(a)
+	}
+
+	files := append([]string{}, cFiles...)
+	files = append(files, filepath.Join(workPath, "out.h"), filepath.Join(workPath, "out.data"))
+	headers, err := filepath.Glob(filepath.Join(runtimePath, "*.h"))
+	if err != nil {
+		return "", err
+	}
+	files = append(files, headers...)
+
+	// Headers of the bindings and bound C libraries.
+	headers, err = includedHeaders(cFiles)
+	if err != nil {
+		return "", err
+	}
+	files = append(files, headers...)
+
+	for _, file := range files {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		if err := h.File(file); err != nil {
+			return "", err
+		}
+	}
+	return h.Sum(), nil
+}
+
+// includedHeaders returns the headers included by the C files goc did not
+// generate, as listed by the compiler. If the toolchain can not list them it
+// returns the headers in the bindings path and the include directories.
+func includedHeaders(cFiles []string) ([]string, error) {
+	cArgs := compileFlags()
+	words := commandWords(cCompiler)
+
+	var headers []string
+	for _, file := range cFiles {
+		if (filepath.Dir(file) == workPath && strings.HasPrefix(filepath.Base(file), "out")) || filepath.Dir(file) == runtimePath {
+			continue
+		}
+
+		flags := toolchain.Depends(file)
+		if flags == nil {
+			return globHeaders(append(includePaths(cArgs), bindingsPath))
+		}
+
+		args := append(append(append([]string{}, words[1:]...), cArgs...), flags...)
+		logvln(words[0], strings.Join(args, " "))
+
+		var output bytes.Buffer
+		cmd := exec.Command(words[0], args...)
+		cmd.Stdout, cmd.Stderr = &output, &output
+		if err := runCommand(cmd); err != nil {
+			if str := strings.TrimSpace(output.String()); str != "" && cancelled() == nil {
+				return nil, errors.New(str)
+			}
+			return nil, err
+		}
+		headers = append(headers, toolchain.ParseDepends(output.String())...)
+	}
+	return headers, nil
+}
+
+// includePaths returns the include directories in the compile flags.
+func includePaths(args []string) []string {
+	var dirs []string
+	for i, a := range args {
+		switch {
+		case (a == "-I" || a == "/I") && i+1 < len(args):
+			dirs = append(dirs, args[i+1])
+		case len(a) > 2 && (strings.HasPrefix(a, "-I") || strings.HasPrefix(a, "/I")):
+			dirs = append(dirs, a[2:])
+		}
+	}
+	return dirs
+}
+
+func globHeaders(dirs []string) ([]string, error) {
+	var headers []string
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.h"))
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, matches...)
+	}
+	return headers, nil
+}
+
+// useIncbin reports if the data segments are written to a file embedded with
+// .incbin, instead of C arrays. It is only selected automatically when goc
+// compiles the C code, c-source output keeps the arrays for portability.
+func useIncbin() bool {
+	switch dataMode {
+	case "incbin":
+		return true
+	case "auto":
+		return translator == "native" && buildmode != "c-source" && toolchain.Incbin()
+	}
+	return false
+}
+
+// compilerID identifies the C compiler by its resolved path and version banner.
+func compilerID() string {
+	path, err := exec.LookPath(commandWords(cCompiler)[0])
+	if err != nil {
+		return cCompiler
+	}
+	return path + "\n" + cCompiler + "\n" + toolchainName + "\n" + compilerBanner
+}
+
 func copyFiles(destPath, path, globs string) error {
 	for _, glob := range strings.Split(globs, " ") {
 		glob := path + "/" + glob
@@ -258,15 +678,55 @@ func About() string {
 	return "build GopherC application"
 }
 
+// NoOutput is returned by Build when the Go compiler produced nothing to translate.
+const NoOutput = 2
+
 var (
+	// Test makes Build compile the package tests instead of the program, the
+	// package in the current directory by default. A package that fails does
+	// not stop the others from being built.
+	Test bool
+
+	// Built is called, when set, after each package is built with its import
+	// path, directory, output and exit status.
+	Built func(importPath, dir, output string, ret int)
+
+	// DisableWatch rejects -watch, for tools that use the output of Build.
+	DisableWatch bool
+
 	cCompiler  = os.Getenv("CC")
+	archiver   = os.Getenv("AR")
 	gocRoot    = os.Getenv("GOCROOT")
 	outputName = "out"
 	entryName  = "main"
 	buildmode  = "exe"
+	jobs       = 1
+	targetName = os.Getenv("GOCTARGET")
+	profile    = os.Getenv("GOCPROFILE")
+	translator = "wabt"
+	symPrefix  string
+
+	deadCodeElimination bool
+
+	debugInfo bool
+
+	// dataMode selects how the data segments are included, see useIncbin.
+	dataMode = "auto"
+
+	// reuseBindings keeps the generated C bindings of the previous build in watch mode.
+	reuseBindings bool
+
+	// configured holds the flags set from the project goc.json.
+	configured = map[string]bool{}
 
 	silent,
 	verbose,
+	forceBuild,
+	keepWork,
+	trimPath,
+	jsonOutput,
+	watchMode,
+	generateMeson,
 	generateCBindings bool
 
 	wabtPath,
@@ -274,11 +734,12 @@ var (
 	goRoot,
 	workPath,
 	bindingsPath,
-	cFlags,
+	ldFlags,
+	gcFlags,
 	buildTags string
 )
 
-func setupFlags() {
+func setupFlags() error {
 	var exePath string
 	if path, err := os.Executable(); err == nil {
 		if final, err := filepath.EvalSymlinks(path); err == nil {
@@ -295,22 +756,69 @@ func setupFlags() {
 		cCompiler = "gcc"
 	}
 
-	flag.StringVar(&cCompiler, "cc", cCompiler, "set default C compiler, 'gcc', 'clang' or 'cl' (CC)")
+	flag.StringVar(&cCompiler, "cc", cCompiler, "set default C compiler, for example 'gcc', 'clang', 'cl', 'tcc' or 'zig cc' (CC)")
+	flag.StringVar(&toolchainName, "toolchain", toolchainName, "C toolchain driver, 'gcc', 'clang', 'msvc', 'tcc' or 'zig', detected from the compiler by default")
+	flag.StringVar(&archiver, "ar", archiver, "set archiver for static builds, 'ar' or 'lib' (AR)")
+	flag.StringVar(&targetName, "target", targetName, "select a target profile from goc.target (GOCTARGET)")
 	flag.StringVar(&buildTags, "tags", "", "a space-separated list of build tags")
+	flag.StringVar(&ldFlags, "ldflags", ldFlags, "arguments to pass on each go tool link invocation")
+	flag.StringVar(&gcFlags, "gcflags", gcFlags, "arguments to pass on each go tool compile invocation")
+	flag.BoolVar(&trimPath, "trimpath", trimPath, "remove all file system paths from the resulting wasm module")
 	flag.StringVar(&wabtPath, "wabt", wabtPath, "wabt tools path")
+	flag.StringVar(&translator, "translator", translator, "wasm to C translator, 'wabt' or 'native'")
 	flag.StringVar(&goRoot, "goroot", goRoot, "Go compiler path")
 	flag.StringVar(&gocRoot, "gocroot", gocRoot, "GopherC compiler path (GOCROOT)")
 	flag.StringVar(&outputName, "o", outputName, "final output name")
-	flag.StringVar(&entryName, "entry", entryName, "name of C entry point")
+	flag.StringVar(&entryName, "entry", entryName, "name of C entry point, 'goc_main' by default for -buildmode static")
 	flag.StringVar(&workPath, "work", workPath, "specify temporary work path")
 	flag.StringVar(&bindingsPath, "bindings", bindingsPath, "specify C bindings path")
-	flag.StringVar(&cFlags, "cflags", cFlags, "extra parameters for the C compiler")
-	flag.StringVar(&buildmode, "buildmode", buildmode, "set compiler buildmode, 'exe', 'shared' or 'c-source'")
+	flag.Var(&cFlags, "cflags", "extra parameters for the C compiler, can be repeated (CFLAGS)")
+	flag.StringVar(&extraLDFlags, "ldflags-c", extraLDFlags, "extra parameters for the C linker (LDFLAGS)")
+	flag.Var(&extraSources, "csrc", "additional C source file or glob pattern to compile, can be repeated")
+	flag.Var(&includeDirs, "I", "add a C include directory, can be repeated")
+	flag.Var(&libraries, "l", "link with a C library, can be repeated")
+	flag.Var(&pkgConfigs, "pkg-config", "use the C flags and libraries of a pkg-config package, can be repeated")
+	flag.StringVar(&buildmode, "buildmode", buildmode, "set compiler buildmode, 'exe', 'shared', 'static' or 'c-source'")
+	flag.IntVar(&jobs, "j", jobs, "number of translation units and parallel C compiler jobs")
+	flag.StringVar(&symPrefix, "prefix", symPrefix, "prefix of the C symbols shared between translation units, made from the output name by default")
 	flag.BoolVar(&generateCBindings, "b", generateCBindings, "generate C bindings")
+	flag.BoolVar(&forceBuild, "a", forceBuild, "force rebuilding, ignore the build cache")
+	flag.BoolVar(&keepWork, "keepwork", keepWork, "print the temporary work path and do not delete it when exiting")
+	flag.BoolVar(&deadCodeElimination, "dce", deadCodeElimination, "remove unreachable functions from the wasm module before C generation, off by default")
+	flag.BoolVar(&debugInfo, "debug", debugInfo, "compile with debug information and map the generated C code to the Go sources, uses the native translator")
+	flag.StringVar(&dataMode, "data", dataMode, "how data segments are included in the C code, 'array', 'incbin' or 'auto' to use incbin when the toolchain supports it, incbin uses the native translator")
+	flag.BoolVar(&generateMeson, "meson", generateMeson, "also write a meson.build file in c-source buildmode")
 	flag.BoolVar(&silent, "s", silent, "silent mode")
+	flag.BoolVar(&jsonOutput, "json", jsonOutput, "write build events as JSON to stdout")
 	flag.BoolVar(&verbose, "v", verbose, "verbose")
+	flag.BoolVar(&watchMode, "watch", watchMode, "rebuild when the Go sources, goc.bind, goc.type or helper_goc.c files change")
+	flag.DurationVar(&timeout, "timeout", timeout, "stop the build if it takes longer than the given duration")
+	flag.StringVar(&profile, "profile", profile, "select a profile from the project goc.json (GOCPROFILE)")
 	flag.Parse()
 
+	applied, err := config.Apply("build", profile)
+	if err != nil {
+		return err
+	}
+	for _, name := range applied {
+		configured[name] = true
+	}
+
+	if debugInfo || dataMode == "incbin" {
+		explicit := configured["translator"]
+		flag.Visit(func(f *flag.Flag) {
+			explicit = explicit || f.Name == "translator"
+		})
+		if !explicit {
+			translator = "native"
+		}
+	}
+
+	if jsonOutput {
+		// Keep stdout clean for the event stream.
+		silent = true
+	}
+
 	if gocRoot == "" {
 		gocRoot = filepath.Clean(filepath.Join(exePath, "..", ".."))
 	}
@@ -324,10 +832,21 @@ func setupFlags() {
 	}
 
 	runtimePath = filepath.Join(gocRoot, "runtime")
+	return nil
 }
 
 func PrintDefaults() {
+	fmt.Println("goc build [flags] [packages or files]")
+	fmt.Println("\nWhen building multiple main packages the outputs are discarded, unless -o")
+	fmt.Println("names a directory to write them to.")
+	fmt.Println("\nThe exit status is 3 to 7 when the bindings, go build, dce, wasm2c or C compile")
+	fmt.Println("stage fails, 124 when the build times out and 130 when it is interrupted.")
+	fmt.Println()
+	PrintFlags()
+}
+
+// PrintFlags prints the build flags, for tools that build on top of goc build.
+func PrintFlags() {
 	setupFlags()
-	fmt.Println("goc build [flags] [input]")
 	flag.PrintDefaults()
 }
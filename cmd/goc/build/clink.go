@@ -0,0 +1,141 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// stringList is a flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// IsListFlag tells the project configuration to set list items one by one.
+func (l *stringList) IsListFlag() bool {
+	return true
+}
+
+var (
+	extraSources,
+	includeDirs,
+	libraries,
+	pkgConfigs stringList
+
+	cFlags stringList
+
+	extraLDFlags string
+
+	// Resolved by setupCLink.
+	extraCFiles,
+	extraCompileFlags,
+	extraLinkFlags,
+	userCFlags,
+	envCFlags,
+	envLDFlags []string
+)
+
+// setupCLink resolves the extra C sources and the compile and link flags, including pkg-config packages.
+func setupCLink() error {
+	var err error
+	if envCFlags, err = splitArgs(os.Getenv("CFLAGS")); err != nil {
+		return fmt.Errorf("CFLAGS: %v", err)
+	}
+	if envLDFlags, err = splitArgs(os.Getenv("LDFLAGS")); err != nil {
+		return fmt.Errorf("LDFLAGS: %v", err)
+	}
+
+	for _, s := range cFlags {
+		words, err := splitArgs(s)
+		if err != nil {
+			return fmt.Errorf("-cflags: %v", err)
+		}
+		userCFlags = append(userCFlags, words...)
+	}
+
+	for _, pattern := range extraSources {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("-csrc: no such file: %s", pattern)
+		}
+		for _, file := range files {
+			file, _ = filepath.Abs(file)
+			extraCFiles = append(extraCFiles, file)
+		}
+	}
+
+	for _, dir := range includeDirs {
+		dir, _ = filepath.Abs(dir)
+		extraCompileFlags = append(extraCompileFlags, toolchain.Include(dir)...)
+	}
+
+	if len(pkgConfigs) > 0 {
+		cflags, err := pkgConfig("--cflags")
+		if err != nil {
+			return err
+		}
+		extraCompileFlags = append(extraCompileFlags, cflags...)
+
+		libs, err := pkgConfig("--libs")
+		if err != nil {
+			return err
+		}
+		extraLinkFlags = append(extraLinkFlags, libs...)
+	}
+
+	for _, lib := range libraries {
+		extraLinkFlags = append(extraLinkFlags, toolchain.Library(lib)...)
+	}
+
+	ldflags, err := splitArgs(extraLDFlags)
+	if err != nil {
+		return fmt.Errorf("-ldflags-c: %v", err)
+	}
+	extraLinkFlags = append(extraLinkFlags, ldflags...)
+	return nil
+}
+
+// pkgConfig queries the flags of all pkg-config packages, PKG_CONFIG selects the program.
+func pkgConfig(query string) ([]string, error) {
+	prog := os.Getenv("PKG_CONFIG")
+	if prog == "" {
+		prog = "pkg-config"
+	}
+
+	args := append([]string{query}, pkgConfigs...)
+	logvln(prog, strings.Join(args, " "))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(prog, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() > 0 {
+			return nil, fmt.Errorf("%s: %s", prog, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("%s: %v", prog, err)
+	}
+	return splitArgs(stdout.String())
+}
+
+// linkFlags returns the flags that goes after the sources or objects when linking.
+func linkFlags() []string {
+	flags := append(append(target.linkFlags(), envLDFlags...), extraLinkFlags...)
+	return toolchain.LinkerOptions(toolchain.TranslateFlags(flags))
+}
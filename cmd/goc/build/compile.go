@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// compileFlags returns the flags shared by every C compile.
+func compileFlags() []string {
+	cArgs := append(toolchain.BaseFlags(), toolchain.Define("GOC_ENTRY="+entryName)...)
+	if buildmode == "static" {
+		cArgs = append(cArgs, toolchain.Define("WASM_RT_MODULE_PREFIX="+modulePrefix)...)
+	}
+	cArgs = append(cArgs, toolchain.Include(runtimePath)...)
+	cArgs = append(cArgs, toolchain.Include(workPath)...)
+
+	var flags []string
+	if debugInfo {
+		flags = append(flags, "-g")
+	}
+	flags = append(flags, target.compileFlags()...)
+	flags = append(flags, extraCompileFlags...)
+	flags = append(flags, envCFlags...)
+	flags = append(flags, userCFlags...)
+	return append(cArgs, toolchain.TranslateFlags(flags)...)
+}
+
+// compileObjects compiles each C file to an object file, running up to jobs compilers at once.
+func compileObjects(cArgs, cFiles []string) ([]string, error) {
+	objPath := filepath.Join(workPath, "obj")
+	if err := os.MkdirAll(objPath, 0755); err != nil {
+		return nil, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	objects := make([]string, len(cFiles))
+	sem := make(chan struct{}, jobs)
+
+	for i, file := range cFiles {
+		// Prefix with the index since bindings from different paths share file names.
+		obj := filepath.Join(objPath, fmt.Sprintf("%d_%s", i, strings.TrimSuffix(filepath.Base(file), ".c")))
+
+		obj += toolchain.ObjectSuffix()
+		args := append(append([]string{}, cArgs...), toolchain.Compile(obj, file)...)
+		objects[i] = obj
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := runCompiler(args...); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return objects, firstErr
+}
+
+// splitSources replaces the wabt wasm2c output with one translation unit per
+// job, the native translator writes the units itself.
+func splitSources(cFiles []string) []string {
+	if jobs < 2 || translator == "native" {
+		return cFiles
+	}
+
+	units, err := splitCSource(cFiles[0], jobs, symbolPrefix())
+	if err != nil {
+		logln("Compiling the C code as one translation unit:", err)
+		return cFiles
+	}
+	logvln("Split C code into", len(units), "translation units")
+	return append(units, cFiles[1:]...)
+}
+
+// linkExecutable compiles and links cFiles into the executable or shared library output.
+func linkExecutable(cFiles []string, output string) error {
+	cArgs := compileFlags()
+	if jobs < 2 {
+		return runCompiler(append(append(append(cArgs, linkOutputFlags(output)...), cFiles...), linkFlags()...)...)
+	}
+
+	objects, err := compileObjects(cArgs, splitSources(cFiles))
+	if err != nil {
+		return err
+	}
+
+	args := toolchain.LinkFlags(cArgs)
+	return runCompiler(append(append(append(args, linkOutputFlags(output)...), objects...), linkFlags()...)...)
+}
+
+func linkOutputFlags(output string) []string {
+	return toolchain.Link(output, buildmode == "shared")
+}
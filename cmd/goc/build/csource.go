@@ -0,0 +1,180 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeBuildFiles writes build system files next to the C sources so the
+// output can be compiled without goc, using the same flags goc would have used.
+func writeBuildFiles(path string, cFiles []string) error {
+	var sources []string
+	for _, file := range cFiles {
+		sources = append(sources, filepath.Base(file))
+	}
+
+	project := strings.TrimSuffix(filepath.Base(outputName), filepath.Ext(outputName))
+	defines := []string{"GOC_ENTRY=" + entryName}
+
+	// CFLAGS and LDFLAGS from the environment are left to the build system.
+	var flags []string
+	if debugInfo {
+		flags = append(flags, "-g")
+	}
+	flags = append(append(append(flags, target.compileFlags()...), extraCompileFlags...), userCFlags...)
+	libs := append(target.linkFlags(), extraLinkFlags...)
+
+	if err := writeMakefile(filepath.Join(path, "Makefile"), project, sources, defines, flags, libs); err != nil {
+		return err
+	}
+
+	if err := writeCMakeLists(filepath.Join(path, "CMakeLists.txt"), project, sources, defines, flags, libs); err != nil {
+		return err
+	}
+
+	if generateMeson {
+		if err := writeMesonBuild(filepath.Join(path, "meson.build"), project, sources, defines, flags, libs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSourceNames reports C files that would overwrite each other when they
+// are copied to the c-source output directory.
+func checkSourceNames(cFiles []string) error {
+	seen := map[string]string{}
+	for _, file := range cFiles {
+		name := strings.ToLower(filepath.Base(file))
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s and %s have the same name in the c-source output", other, file)
+		}
+		seen[name] = file
+	}
+	return nil
+}
+
+func writeMakefile(name, project string, sources, defines, flags, libs []string) error {
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	// The Makefile uses the gcc command line syntax.
+	cc, base := cCompiler, toolchain.BaseFlags()
+	if toolchain.Name() == "msvc" {
+		cc, base = "cc", gccToolchain{}.BaseFlags()
+	}
+
+	fmt.Fprint(fp, "# Generated by the GopherC build tool.\n\n")
+	fmt.Fprintf(fp, "CC = %s\n", cc)
+	fmt.Fprint(fp, "GOC_CFLAGS =")
+	for _, f := range base {
+		fmt.Fprintf(fp, " %s", quoteMake(f))
+	}
+	fmt.Fprint(fp, " -I.")
+	for _, d := range defines {
+		fmt.Fprintf(fp, " -D%s", quoteMake(d))
+	}
+	for _, f := range flags {
+		fmt.Fprintf(fp, " %s", quoteMake(f))
+	}
+	fmt.Fprint(fp, "\nLDLIBS =")
+	for _, f := range libs {
+		fmt.Fprintf(fp, " %s", quoteMake(f))
+	}
+	fmt.Fprint(fp, "\n\n")
+
+	fmt.Fprintf(fp, "TARGET = %s\n", project)
+	fmt.Fprintf(fp, "SOURCES = %s\n", strings.Join(sources, " "))
+	fmt.Fprint(fp, "OBJECTS = $(SOURCES:.c=.o)\n\n")
+
+	fmt.Fprint(fp, "all: $(TARGET)\n\n")
+	fmt.Fprint(fp, "$(TARGET): $(OBJECTS)\n\t$(CC) $(GOC_CFLAGS) $(CFLAGS) $(LDFLAGS) -o $@ $(OBJECTS) $(LDLIBS)\n\n")
+	fmt.Fprintf(fp, "%%.o: %%.c\n\t$(CC) $(GOC_CFLAGS) $(CFLAGS) -c -o $@ $<\n\n")
+	fmt.Fprint(fp, "clean:\n\trm -f $(TARGET) $(OBJECTS)\n\n")
+	fmt.Fprint(fp, ".PHONY: all clean\n")
+	return nil
+}
+
+func writeCMakeLists(name, project string, sources, defines, flags, libs []string) error {
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	fmt.Fprint(fp, "# Generated by the GopherC build tool.\n\n")
+	fmt.Fprint(fp, "cmake_minimum_required(VERSION 3.1)\n")
+	fmt.Fprintf(fp, "project(%s C)\n\n", project)
+
+	fmt.Fprintf(fp, "add_executable(%s %s)\n", project, strings.Join(sources, " "))
+	fmt.Fprintf(fp, "set_target_properties(%s PROPERTIES C_STANDARD 99 C_EXTENSIONS OFF)\n", project)
+	fmt.Fprintf(fp, "target_include_directories(%s PRIVATE ${CMAKE_CURRENT_SOURCE_DIR})\n", project)
+	fmt.Fprintf(fp, "target_compile_definitions(%s PRIVATE %s)\n", project, strings.Join(quoteCMake(defines), " "))
+	if len(flags) > 0 {
+		fmt.Fprintf(fp, "target_compile_options(%s PRIVATE %s)\n", project, strings.Join(quoteCMake(flags), " "))
+	}
+
+	if len(libs) > 0 {
+		fmt.Fprintf(fp, "target_link_libraries(%s %s)\n", project, strings.Join(quoteCMake(libs), " "))
+	}
+	return nil
+}
+
+func writeMesonBuild(name, project string, sources, defines, flags, libs []string) error {
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	var args []string
+	for _, d := range defines {
+		args = append(args, "-D"+d)
+	}
+	args = append(args, flags...)
+
+	fmt.Fprint(fp, "# Generated by the GopherC build tool.\n\n")
+	fmt.Fprintf(fp, "project('%s', 'c', default_options : ['c_std=c99'])\n\n", project)
+	fmt.Fprintf(fp, "executable('%s', %s,\n", project, mesonList(sources))
+	fmt.Fprint(fp, "\tinclude_directories : include_directories('.'),\n")
+	fmt.Fprintf(fp, "\tc_args : %s,\n", mesonList(args))
+	fmt.Fprintf(fp, "\tlink_args : %s)\n", mesonList(libs))
+	return nil
+}
+
+// quoteMake quotes a word for the shell that runs the Makefile recipes.
+func quoteMake(s string) string {
+	s = strings.Replace(s, "$", "$$", -1)
+	if strings.ContainsAny(s, " \t'\"\\#*?;&|<>()`") {
+		s = "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+	// Make does not know about shell quotes, so comments must be escaped too.
+	return strings.Replace(s, "#", `\#`, -1)
+}
+
+func quoteCMake(lst []string) []string {
+	var result []string
+	for _, s := range lst {
+		if strings.ContainsAny(s, " ;\"()$\\") {
+			s = "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "$", "\\$").Replace(s) + "\""
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func mesonList(lst []string) string {
+	var quoted []string
+	for _, s := range lst {
+		quoted = append(quoted, "'"+strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(s)+"'")
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
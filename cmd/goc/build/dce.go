@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+)
+
+// eliminateDeadCode writes a copy of the input module without unreachable
+// functions and a report listing what was removed.
+func eliminateDeadCode(input, output, reportFile string) (*wasm.DCEReport, error) {
+	m, err := wasm.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := wasm.EliminateDeadCode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := wasm.WriteFile(output, m); err != nil {
+		return nil, err
+	}
+
+	fp, err := os.Create(reportFile)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	w := bufio.NewWriter(fp)
+	fmt.Fprintln(w, dceSummary(report))
+	for _, name := range report.Removed {
+		fmt.Fprintln(w, name)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func dceSummary(report *wasm.DCEReport) string {
+	return fmt.Sprintf("Removed %d of %d functions (%d bytes), %d table entries", len(report.Removed), report.Funcs, report.RemovedBytes, report.TableEntries)
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/config"
+	"github.com/gopherc/goc/cmd/goc/wasm2c"
+)
+
+// Check is the result of one goc doctor check.
+type Check struct {
+	Name string
+	Err  error
+
+	// Fix suggests how to resolve a failed check.
+	Fix string
+}
+
+// The symbols goc-rt.c expects from the generated module.
+var runtimeExports = []string{"Z_runZ_vii", "Z_resumeZ_vv", "Z_getspZ_iv", "Z_mem"}
+
+const doctorMain = `package main
+
+func main() {
+	if tagged {
+		println("goc")
+	}
+}
+`
+
+const doctorTag = `// +build goc
+
+package main
+
+const tagged = true
+`
+
+// A minimal module that writes a line through goc-rt.c and exits.
+const doctorModule = `#include <string.h>
+#include "wasm-rt.h"
+
+extern void (*Z_goZ_runtimeZ2EwasmWriteZ_vi)(uint32_t);
+extern void (*Z_goZ_runtimeZ2EwasmExitZ_vi)(uint32_t);
+
+static wasm_rt_memory_t memory;
+
+static void run(uint32_t argc, uint32_t argv) {
+	static const char msg[] = "goc doctor\n";
+	int64_t fd = 1, p = 64, n = sizeof(msg) - 1;
+	int32_t code = 0;
+	(void)argc; (void)argv;
+
+	memcpy(memory.data + p, msg, sizeof(msg) - 1);
+	memcpy(memory.data + 8, &fd, 8);
+	memcpy(memory.data + 16, &p, 8);
+	memcpy(memory.data + 24, &n, 4);
+	Z_goZ_runtimeZ2EwasmWriteZ_vi(0);
+
+	memcpy(memory.data + 8, &code, 4);
+	Z_goZ_runtimeZ2EwasmExitZ_vi(0);
+}
+
+static void resume(void) {}
+static uint32_t getsp(void) { return 0; }
+
+void (*Z_runZ_vii)(uint32_t, uint32_t);
+void (*Z_resumeZ_vv)();
+uint32_t (*Z_getspZ_iv)();
+wasm_rt_memory_t *Z_mem;
+
+void init() {
+	wasm_rt_allocate_memory(&memory, 1, 1);
+	Z_runZ_vii = run;
+	Z_resumeZ_vv = resume;
+	Z_getspZ_iv = getsp;
+	Z_mem = &memory;
+}
+`
+
+// Diagnose parses the build flags and verifies that every part of the toolchain works.
+func Diagnose() []Check {
+	var checks []Check
+	add := func(name string, err error, fix string, args ...interface{}) bool {
+		c := Check{Name: name, Err: err}
+		if err != nil {
+			c.Fix = fmt.Sprintf(fix, args...)
+		}
+		checks = append(checks, c)
+		return err == nil
+	}
+
+	if !add("config", setupFlags(), "fix the flags or the project %s", config.FileName) {
+		return checks
+	}
+	jobs = 1
+	buildmode = "exe"
+
+	wd, err := os.Getwd()
+	if err == nil {
+		err = setupTarget(wd)
+	}
+	if !add("target", err, "check the -target name and the goc.target files in %s and the project", gocRoot) {
+		return checks
+	}
+
+	goRT := filepath.Join(runtimePath, "goc-rt.c")
+	runtimeOK := add("runtime", missingFiles(goRT, filepath.Join(runtimePath, "wasm-rt.h")),
+		"reinstall GopherC or point -gocroot (GOCROOT) at the installation directory")
+
+	tempPath, err := ioutil.TempDir("", "goc-doctor")
+	if !add("work", err, "make sure the temporary directory is writable") {
+		return checks
+	}
+	defer os.RemoveAll(tempPath)
+	workPath = tempPath
+
+	// The Go fork must build js/wasm and honor the goc build tag.
+	wasmFile := filepath.Join(workPath, "out.wasm")
+	goBin := filepath.Join(goRoot, "bin", "go")
+	err = writeFiles(workPath, map[string]string{"main.go": doctorMain, "tag_goc.go": doctorTag})
+	if err == nil {
+		os.Setenv("GOOS", "js")
+		os.Setenv("GOARCH", "wasm")
+		os.Setenv("GOROOT", goRoot)
+		err = runProgram(goBin, workPath, "build", "-tags", "goc", "-o", wasmFile, "main.go", "tag_goc.go")
+	}
+	goOK := add("go", err, "the Go toolchain at %s can not build js/wasm with the goc tag, run build.sh to build the GopherC Go fork or use -goroot", goRoot)
+
+	// The translator must produce the symbols goc-rt.c links against.
+	if !goOK {
+		add("wasm2c", errors.New("skipped, no wasm module to translate"), "fix the go check first")
+	} else {
+		err := translateDoctorModule(wasmFile)
+		fix := "rebuild wabt with build.sh, or use -translator native"
+		if translator == "native" {
+			fix = "report this as a GopherC bug"
+		}
+		if add("wasm2c", err, fix) && runtimeOK {
+			missingExports, missingImports, err := moduleSymbols(filepath.Join(workPath, "out.h"), goRT)
+			if err == nil && len(missingExports) > 0 {
+				err = fmt.Errorf("module does not export: %s", strings.Join(missingExports, ", "))
+			}
+			add("exports", err, "the wasm2c output does not match goc-rt.c, %s", fix)
+
+			err = nil
+			if len(missingImports) > 0 {
+				err = fmt.Errorf("goc-rt.c does not implement: %s", strings.Join(missingImports, ", "))
+			}
+			add("imports", err, "the Go toolchain at %s is probably not the GopherC fork, run build.sh or use -goroot", goRoot)
+		}
+	}
+
+	// The C compiler must compile and link goc-rt.c with a trivial module.
+	if !runtimeOK {
+		add("cc", errors.New("skipped, runtime files are missing"), "fix the runtime check first")
+		return checks
+	}
+
+	if _, err := exec.LookPath(commandWords(cCompiler)[0]); err != nil {
+		add("cc", err, "install a C compiler or select one with -cc (CC) or -target")
+		return checks
+	}
+
+	outputName = filepath.Join(workPath, "doctor")
+	if target.ExeSuffix != "" {
+		outputName += target.ExeSuffix
+	}
+	moduleFile := filepath.Join(workPath, "module.c")
+	err = writeFiles(workPath, map[string]string{"module.c": doctorModule})
+	if err == nil {
+		err = linkExecutable([]string{moduleFile, goRT}, outputName)
+	}
+	if !add("cc", err, "%s could not build goc-rt.c, check the compiler installation and -cflags", cCompiler) {
+		return checks
+	}
+
+	if targetName != "" {
+		// Cross compiled programs can not be expected to run here.
+		return checks
+	}
+
+	out, err := exec.Command(outputName).Output()
+	if err == nil && string(out) != "goc doctor\n" {
+		err = fmt.Errorf("unexpected output: %q", out)
+	}
+	add("run", err, "the executable built by %s does not run on this machine, check the compiler and C library installation", cCompiler)
+	return checks
+}
+
+func translateDoctorModule(wasmFile string) error {
+	if translator == "native" {
+		return wasm2c.TranslateFile(wasmFile, filepath.Join(workPath, "out.c"), wasm2c.Options{})
+	}
+
+	wasm2cBin := filepath.Join(wabtPath, "wasm2c")
+	if _, err := exec.LookPath(wasm2cBin); err != nil {
+		return err
+	}
+	return runProgram(wasm2cBin, workPath, wasmFile, "-o", "out.c")
+}
+
+var symbolRegexp = regexp.MustCompile(`Z_\w+`)
+
+// moduleSymbols returns the exports goc-rt.c needs that are missing from the
+// header and the imported functions that goc-rt.c does not implement.
+func moduleSymbols(header, goRT string) (missingExports, missingImports []string, err error) {
+	fp, err := os.Open(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fp.Close()
+
+	rt, err := ioutil.ReadFile(goRT)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		exported = map[string]bool{}
+		isExport bool
+	)
+
+	s := bufio.NewScanner(fp)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "/* export:") {
+			isExport = true
+			continue
+		}
+		if !strings.HasPrefix(line, "extern") {
+			continue
+		}
+
+		name := symbolRegexp.FindString(line)
+		if name == "" {
+			continue
+		}
+
+		for _, exp := range runtimeExports {
+			isExport = isExport || name == exp
+		}
+		if isExport {
+			exported[name] = true
+		} else if !strings.Contains(string(rt), "IMPL("+name+")") {
+			missingImports = append(missingImports, name)
+		}
+		isExport = false
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range runtimeExports {
+		if !exported[name] {
+			missingExports = append(missingExports, name)
+		}
+	}
+	return missingExports, missingImports, nil
+}
+
+func missingFiles(files ...string) error {
+	var missing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			missing = append(missing, file)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/gopherc/goc/cmd/goc/cache"
+	"github.com/gopherc/goc/cmd/goc/config"
+)
+
+// Setting is a resolved build setting, as reported by goc env.
+type Setting struct {
+	Name  string
+	Value string
+
+	// Source is where the value came from, 'flag', 'config', 'env', 'target',
+	// 'detected' or 'default'.
+	Source string
+
+	// Exists is set for settings that refers to a file, directory or program.
+	Exists *bool `json:",omitempty"`
+}
+
+// Settings parses the build flags and returns the resolved settings.
+func Settings() ([]Setting, error) {
+	if err := setupFlags(); err != nil {
+		return nil, err
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := setupTarget(wd); err != nil {
+		return nil, err
+	}
+
+	source := func(flagName, envName, fallback string) string {
+		switch {
+		case flagName != "" && configured[flagName]:
+			return "config"
+		case flagName != "" && explicit[flagName]:
+			return "flag"
+		case envName != "" && os.Getenv(envName) != "":
+			return "env"
+		}
+		return fallback
+	}
+
+	pathExists := func(path string) *bool {
+		_, err := os.Stat(path)
+		exists := err == nil
+		return &exists
+	}
+
+	programExists := func(name string) *bool {
+		_, err := exec.LookPath(commandWords(name)[0])
+		exists := err == nil
+		return &exists
+	}
+
+	toolSource := func(flagName, envName string) string {
+		if targetName != "" && !explicit[flagName] && !configured[flagName] {
+			return "target"
+		}
+		return source(flagName, envName, "default")
+	}
+
+	goBin := filepath.Join(goRoot, "bin", "go")
+	wasm2cBin := filepath.Join(wabtPath, "wasm2c")
+	if runtime.GOOS == "windows" {
+		goBin += ".exe"
+		wasm2cBin += ".exe"
+	}
+
+	toolchainSource := source("toolchain", "", "detected")
+	if toolchainSource == "detected" && target.Syntax != "" {
+		toolchainSource = "target"
+	}
+
+	data, dataSource := "array", source("data", "", "detected")
+	if useIncbin() {
+		data = "incbin"
+	}
+
+	settings := []Setting{
+		{"GOCROOT", gocRoot, source("gocroot", "GOCROOT", "default"), pathExists(gocRoot)},
+		{"GOCTARGET", targetName, source("target", "GOCTARGET", "default"), nil},
+		{"GOCPROFILE", profile, source("profile", "GOCPROFILE", "default"), nil},
+		{"GOCCONFIG", config.Find(), "default", nil},
+		{"GOCCACHE", cache.Dir(), source("", "GOCCACHE", "default"), pathExists(cache.Dir())},
+		{"GOROOT", goRoot, source("goroot", "", "default"), pathExists(goRoot)},
+		{"GO", goBin, source("goroot", "", "default"), pathExists(goBin)},
+		{"TRANSLATOR", translator, source("translator", "", "default"), nil},
+		{"WABT", wabtPath, source("wabt", "", "default"), pathExists(wabtPath)},
+		{"WASM2C", wasm2cBin, source("wabt", "", "default"), pathExists(wasm2cBin)},
+		{"RUNTIME", runtimePath, source("gocroot", "GOCROOT", "default"), pathExists(runtimePath)},
+		{"GOCRT", filepath.Join(runtimePath, "goc-rt.c"), source("gocroot", "GOCROOT", "default"), pathExists(filepath.Join(runtimePath, "goc-rt.c"))},
+		{"WASMRT", filepath.Join(runtimePath, "wasm-rt.h"), source("gocroot", "GOCROOT", "default"), pathExists(filepath.Join(runtimePath, "wasm-rt.h"))},
+		{"CC", target.CC, toolSource("cc", "CC"), programExists(target.CC)},
+		{"AR", target.AR, toolSource("ar", "AR"), programExists(target.AR)},
+		{"TOOLCHAIN", toolchainName, toolchainSource, nil},
+		{"CFLAGS", joinFlags(os.Getenv("CFLAGS"), cFlags.String()), source("cflags", "CFLAGS", "default"), nil},
+		{"LDFLAGS", joinFlags(os.Getenv("LDFLAGS"), extraLDFlags), source("ldflags-c", "LDFLAGS", "default"), nil},
+		{"BUILDMODE", buildmode, source("buildmode", "", "default"), nil},
+		{"DATA", data, dataSource, nil},
+	}
+	return settings, nil
+}
+
+// joinFlags joins the environment and command line flags, in the order they are passed to the C compiler.
+func joinFlags(env, flags string) string {
+	if env == "" || flags == "" {
+		return env + flags
+	}
+	return env + " " + flags
+}
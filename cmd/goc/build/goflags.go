@@ -0,0 +1,150 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Linker and compiler options that can not be used when building for js/wasm.
+var (
+	unsupportedLDFlags = map[string]string{
+		"linkmode":      "js/wasm only supports internal linking",
+		"extld":         "js/wasm only supports internal linking",
+		"extldflags":    "js/wasm only supports internal linking",
+		"linkshared":    "js/wasm does not support shared libraries",
+		"buildmode":     "use goc -buildmode instead",
+		"H":             "the executable format is fixed for js/wasm",
+		"E":             "goc-rt.c expects the default entry point",
+		"T":             "the text address is fixed for js/wasm",
+		"R":             "the text address is fixed for js/wasm",
+		"race":          "the race detector is not supported on js/wasm",
+		"msan":          "the memory sanitizer is not supported on js/wasm",
+		"asan":          "the address sanitizer is not supported on js/wasm",
+		"installsuffix": "the standard library is fixed for js/wasm",
+	}
+
+	unsupportedGCFlags = map[string]string{
+		"shared":  "js/wasm does not support shared libraries",
+		"dynlink": "js/wasm does not support shared libraries",
+		"race":    "the race detector is not supported on js/wasm",
+		"msan":    "the memory sanitizer is not supported on js/wasm",
+		"asan":    "the address sanitizer is not supported on js/wasm",
+	}
+)
+
+// goBuildFlags returns the extra arguments for go build and rejects options that do not work with js/wasm.
+func goBuildFlags() ([]string, error) {
+	var args []string
+	if ldFlags != "" {
+		if err := checkGoFlags("-ldflags", ldFlags, unsupportedLDFlags); err != nil {
+			return nil, err
+		}
+		args = append(args, "-ldflags", ldFlags)
+	}
+
+	if gcFlags != "" {
+		if err := checkGoFlags("-gcflags", gcFlags, unsupportedGCFlags); err != nil {
+			return nil, err
+		}
+		args = append(args, "-gcflags", gcFlags)
+	}
+
+	if trimPath {
+		args = append(args, "-trimpath")
+	}
+	return args, nil
+}
+
+// checkGoFlags validates a flag list as given to go build, optionally prefixed with a package pattern.
+func checkGoFlags(name, value string, unsupported map[string]string) error {
+	// Package specific flags are given as 'pattern=flags'.
+	if !strings.HasPrefix(value, "-") {
+		if i := strings.Index(value, "="); i >= 0 {
+			value = value[i+1:]
+		}
+	}
+
+	words, err := splitArgs(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	for _, w := range words {
+		if !strings.HasPrefix(w, "-") {
+			continue
+		}
+
+		opt := strings.TrimLeft(w, "-")
+		if i := strings.Index(opt, "="); i >= 0 {
+			opt = opt[:i]
+		}
+		if reason, ok := unsupported[opt]; ok {
+			return fmt.Errorf("%s: -%s is not supported, %s", name, opt, reason)
+		}
+	}
+	return nil
+}
+
+// splitArgs splits s into words like a POSIX shell would, single or double
+// quotes groups words and a backslash escapes the next character. Backslashes
+// are kept on Windows since they separate paths there.
+func splitArgs(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		escaped bool
+		quote   rune
+	)
+
+	escapes := runtime.GOOS != "windows"
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			// Inside double quotes only a few characters can be escaped.
+			if quote == '"' && c != '"' && c != '\\' && c != '$' && c != '`' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && escapes && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
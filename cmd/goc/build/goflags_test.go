@@ -0,0 +1,80 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+
+		// escapes is set for cases that depend on backslash escapes, which are not used on Windows.
+		escapes bool
+	}{
+		{in: "", want: nil},
+		{in: " \t\n ", want: nil},
+		{in: "-O2 -g", want: []string{"-O2", "-g"}},
+		{in: "  -O2\t\t-g\n", want: []string{"-O2", "-g"}},
+		{in: `-DNAME="a b"`, want: []string{"-DNAME=a b"}},
+		{in: `'-DMSG="hi there"'`, want: []string{`-DMSG="hi there"`}},
+		{in: `"-I/path with spaces" -Ifoo`, want: []string{"-I/path with spaces", "-Ifoo"}},
+		{in: `''`, want: []string{""}},
+		{in: `a""b`, want: []string{"ab"}},
+		{in: `"a"'b'c`, want: []string{"abc"}},
+		{in: `'$HOME \n'`, want: []string{`$HOME \n`}},
+		{in: `a\ b`, want: []string{"a b"}, escapes: true},
+		{in: `\"a\"`, want: []string{`"a"`}, escapes: true},
+		{in: `\'`, want: []string{"'"}, escapes: true},
+		{in: `\\`, want: []string{`\`}, escapes: true},
+		{in: `"a\"b"`, want: []string{`a"b`}, escapes: true},
+		{in: `"a\nb"`, want: []string{`a\nb`}, escapes: true},
+		{in: `"\$x \\ \` + "`" + `"`, want: []string{"$x \\ `"}, escapes: true},
+		{in: `'a\'`, want: []string{`a\`}, escapes: true},
+		{in: `-DX=\"1\"`, want: []string{`-DX="1"`}, escapes: true},
+	}
+
+	for _, test := range tests {
+		if test.escapes && runtime.GOOS == "windows" {
+			continue
+		}
+		got, err := splitArgs(test.in)
+		if err != nil {
+			t.Errorf("splitArgs(%q): %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSplitArgsWindowsPaths(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("backslashes are escapes")
+	}
+	got, err := splitArgs(`-IC:\goc\include "-IC:\Program Files\x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`-IC:\goc\include`, `-IC:\Program Files\x`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitArgsErrors(t *testing.T) {
+	tests := []string{`"unterminated`, `'unterminated`, `a "b' c`}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, `trailing\`, `"\"`)
+	}
+	for _, in := range tests {
+		if words, err := splitArgs(in); err == nil {
+			t.Errorf("splitArgs(%q) = %q, want an error", in, words)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/gopherc/goc/cmd/goc/watch"
+)
+
+// Exit statuses of Build when a stage fails, setup errors use -1.
+const (
+	ExitBindings = 3 + iota
+	ExitGoBuild
+	ExitDCE
+	ExitWasm2C
+	ExitCCompile
+
+	// ExitTimeout and ExitInterrupted follow the conventions of timeout(1) and the shells.
+	ExitTimeout     = 124
+	ExitInterrupted = watch.ExitInterrupted
+)
+
+var stageStatus = map[string]int{
+	"bindings":  ExitBindings,
+	"go build":  ExitGoBuild,
+	"dce":       ExitDCE,
+	"wasm2c":    ExitWasm2C,
+	"C compile": ExitCCompile,
+	"C source":  ExitCCompile,
+}
+
+var (
+	// interrupted is cancelled on the first interrupt or termination signal,
+	// ctx is the context of the current build and includes the -timeout.
+	interrupted = context.Background()
+	ctx         = context.Background()
+
+	timeout time.Duration
+)
+
+// handleInterrupt cancels the build on the first interrupt, a second
+// interrupt kills goc directly. It returns a function that restores the
+// default signal handling.
+func handleInterrupt() func() {
+	var stop func()
+	interrupted, stop = watch.Interrupted()
+	return stop
+}
+
+// withTimeout sets the context of a build, the returned function releases it.
+func withTimeout() context.CancelFunc {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(interrupted, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(interrupted)
+	}
+	return cancel
+}
+
+// cancelled returns the reason the build was stopped, or nil if it was not.
+func cancelled() error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return errors.New("interrupted")
+}
+
+// cancelStatus returns the exit status of a cancelled build.
+func cancelStatus() int {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ExitTimeout
+	}
+	return ExitInterrupted
+}
+
+// runCommand runs cmd and terminates it, and the processes it started, when the build is cancelled.
+func runCommand(cmd *exec.Cmd) error {
+	if err := cancelled(); err != nil {
+		return err
+	}
+
+	prepareCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killCommand(cmd)
+		case <-exited:
+		}
+	}()
+
+	err := cmd.Wait()
+	if cerr := cancelled(); cerr != nil {
+		return cerr
+	}
+	return err
+}
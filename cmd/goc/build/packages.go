@@ -0,0 +1,170 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type goPackage struct {
+	Name, ImportPath, Dir string
+	ModulePath, ModuleDir string
+
+	// Files is set when the package is given as a list of Go files.
+	Files []string
+}
+
+// root is the directory used for bindings and project files.
+func (p *goPackage) root() string {
+	if p.ModuleDir != "" {
+		return p.ModuleDir
+	}
+	return p.Dir
+}
+
+// resolvePackages turns the command line input in to packages, either a list
+// of Go files or package patterns resolved by go list.
+func resolvePackages(inputs []string) ([]*goPackage, error) {
+	var files []string
+	for _, input := range inputs {
+		if strings.HasSuffix(input, ".go") {
+			file, _ := filepath.Abs(input)
+			files = append(files, file)
+		}
+	}
+
+	if len(files) > 0 {
+		if len(files) != len(inputs) {
+			return nil, errors.New("cannot mix Go files and packages")
+		}
+		name := strings.TrimSuffix(filepath.Base(files[0]), ".go")
+		return []*goPackage{{Name: "main", ImportPath: name, Dir: filepath.Dir(files[0]), Files: files}}, nil
+	}
+
+	args := []string{
+		"list", "-e",
+		"-tags", "goc" + buildTags,
+		"-f", "{{.Name}}\t{{.ImportPath}}\t{{.Dir}}\t{{if .Module}}{{.Module.Path}}\t{{.Module.Dir}}{{end}}\t{{if .Error}}{{.Error}}{{end}}",
+	}
+
+	cmd := exec.Command(filepath.Join(goRoot, "bin", "go"), append(args, inputs...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(cmd); err != nil {
+		if str := strings.TrimSpace(stderr.String()); str != "" && cancelled() == nil {
+			return nil, errors.New(str)
+		}
+		return nil, err
+	}
+
+	var pkgs []*goPackage
+	for _, line := range strings.Split(strings.TrimRight(stdout.String(), "\r\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 6 {
+			continue
+		}
+
+		if fields[5] != "" {
+			return nil, errors.New(fields[5])
+		}
+
+		pkg := &goPackage{
+			Name:       fields[0],
+			ImportPath: fields[1],
+			Dir:        fields[2],
+			ModulePath: fields[3],
+			ModuleDir:  fields[4],
+		}
+
+		// Only main packages produces anything to translate, unless we are testing.
+		if pkg.Name == "main" || Test {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no main packages to build: %s", strings.Join(inputs, " "))
+	}
+	return pkgs, nil
+}
+
+// packageOutputs names the output of each package. When -o is a directory
+// each output is named after its package. Like go build, the outputs of
+// several packages are discarded without -o, they are only built to check
+// that they compile.
+func packageOutputs(pkgs []*goPackage) ([]string, error) {
+	var explicit bool
+	flag.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "o"
+	})
+
+	outputDir := ""
+	if explicit {
+		if strings.HasSuffix(outputName, "/") || strings.HasSuffix(outputName, string(filepath.Separator)) {
+			outputDir = outputName
+		} else if info, err := os.Stat(outputName); err == nil && info.IsDir() && buildmode != "c-source" {
+			outputDir = outputName
+		}
+	}
+
+	if len(pkgs) == 1 && outputDir == "" {
+		return []string{outputName}, nil
+	}
+
+	if explicit && outputDir == "" {
+		return nil, errors.New("-o must be a directory when building multiple packages")
+	}
+
+	var outputs []string
+	if !explicit {
+		logln("Discarding the outputs of multiple packages, use -o dir/ to keep them")
+
+		// Each package is built in its own work directory, see buildPackages.
+		for i, pkg := range pkgs {
+			outputs = append(outputs, filepath.Join(workPath, fmt.Sprint(i), path.Base(pkg.ImportPath)+outputSuffix()))
+		}
+		return outputs, nil
+	}
+
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pkg := range pkgs {
+		outputs = append(outputs, filepath.Join(outputDir, path.Base(pkg.ImportPath)+outputSuffix()))
+	}
+	return outputs, nil
+}
+
+func outputSuffix() string {
+	switch buildmode {
+	case "exe":
+		if target.ExeSuffix != "" {
+			return target.ExeSuffix
+		}
+		if runtime.GOOS == "windows" {
+			return ".exe"
+		}
+	case "shared":
+		return target.SharedSuffix
+	case "static":
+		if target.StaticSuffix != "" {
+			return target.StaticSuffix
+		}
+		return toolchain.StaticSuffix()
+	}
+	return ""
+}
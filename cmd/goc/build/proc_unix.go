@@ -0,0 +1,22 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+//go:build !windows
+// +build !windows
+
+package build
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// prepareCommand starts the command in its own process group, so the
+// compilers started by go build can be terminated with it.
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killCommand(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
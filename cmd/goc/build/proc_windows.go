@@ -0,0 +1,18 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func prepareCommand(cmd *exec.Cmd) {
+}
+
+// killCommand terminates the process tree, since go build starts the compiler and linker as children.
+func killCommand(cmd *exec.Cmd) {
+	exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	cmd.Process.Kill()
+}
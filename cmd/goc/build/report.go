@@ -0,0 +1,214 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is written to stdout for every build stage and command in -json mode.
+type Event struct {
+	Time    time.Time
+	Action  string
+	Package string `json:",omitempty"`
+	Stage   string `json:",omitempty"`
+
+	// Set for the 'run' action.
+	Command  []string   `json:",omitempty"`
+	Dir      string     `json:",omitempty"`
+	Start    *time.Time `json:",omitempty"`
+	ExitCode *int       `json:",omitempty"`
+	Stderr   string     `json:",omitempty"`
+
+	// Set for the 'output' action.
+	Output string `json:",omitempty"`
+
+	// Set when a stage or the build ends.
+	Elapsed   float64    `json:",omitempty"`
+	Cached    bool       `json:",omitempty"`
+	Artifacts []Artifact `json:",omitempty"`
+	Error     string     `json:",omitempty"`
+}
+
+type Artifact struct {
+	Path string
+	Size int64
+}
+
+var (
+	reportMu       sync.Mutex
+	reportEncoder  = json.NewEncoder(os.Stdout)
+	currentPackage string
+)
+
+func emit(e *Event) {
+	if !jsonOutput {
+		return
+	}
+
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	e.Package = currentPackage
+	reportEncoder.Encode(e)
+}
+
+// OutputWriter returns where the output of a built program goes, like the
+// program run by goc run. It is stdout, unless -json is set, then the output
+// is written as 'output' events so the event stream can still be parsed.
+func OutputWriter() io.Writer {
+	if !jsonOutput {
+		return os.Stdout
+	}
+	return outputWriter{}
+}
+
+type outputWriter struct{}
+
+func (outputWriter) Write(p []byte) (int, error) {
+	emit(&Event{Time: time.Now(), Action: "output", Output: string(p)})
+	return len(p), nil
+}
+
+type stage struct {
+	name   string
+	start  time.Time
+	cached bool
+
+	// outputs are removed if the stage fails, so no partial files are left.
+	outputs []string
+
+	// temp and final are the names, without extension, of the temporary and
+	// the final output, see tempOutput.
+	temp, final string
+}
+
+func beginStage(name string, outputs ...string) *stage {
+	s := &stage{name: name, start: time.Now(), outputs: outputs}
+	emit(&Event{Time: s.start, Action: "start", Stage: name})
+	return s
+}
+
+// done ends the stage successfully and reports the files it produced.
+func (s *stage) done(artifacts ...string) {
+	e := &Event{Time: time.Now(), Action: "pass", Stage: s.name, Cached: s.cached}
+	e.Elapsed = e.Time.Sub(s.start).Seconds()
+	for _, file := range artifacts {
+		if info, err := os.Stat(file); err == nil {
+			e.Artifacts = append(e.Artifacts, Artifact{file, info.Size()})
+		}
+	}
+	emit(e)
+}
+
+// fail ends the stage with an error and returns the exit status of the build,
+// which tells what stage failed or if the build was cancelled.
+func (s *stage) fail(err error) int {
+	status, ok := stageStatus[s.name]
+	if !ok {
+		status = -1
+	}
+	if cerr := cancelled(); cerr != nil {
+		err = fmt.Errorf("%s: %v", s.name, cerr)
+		status = cancelStatus()
+	}
+
+	for _, file := range append(s.outputs, s.tempFiles()...) {
+		os.Remove(file)
+	}
+	fmt.Fprintln(os.Stderr, err)
+
+	e := &Event{Time: time.Now(), Action: "fail", Stage: s.name, Error: err.Error()}
+	e.Elapsed = e.Time.Sub(s.start).Seconds()
+	emit(e)
+	return status
+}
+
+// tempOutput returns the name the stage writes the output name to. The files
+// written under it, including the ones a linker adds like import libraries,
+// replace the previous outputs on commit, so a failed build leaves them in
+// place. The extension is kept since some compilers add one if it is missing.
+func (s *stage) tempOutput(name string) string {
+	ext := filepath.Ext(name)
+	s.final = strings.TrimSuffix(name, ext)
+	s.temp = filepath.Join(filepath.Dir(name), fmt.Sprintf(".%s.%d.tmp", filepath.Base(s.final), os.Getpid()))
+	return s.temp + ext
+}
+
+// tempFiles returns the files written under the temporary output name.
+func (s *stage) tempFiles() []string {
+	if s.temp == "" {
+		return nil
+	}
+
+	dir, prefix := filepath.Split(s.temp)
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "."))
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, info := range infos {
+		if name := info.Name(); name == prefix || strings.HasPrefix(name, prefix+".") {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files
+}
+
+// finalName returns the name a temporary output is renamed to.
+func (s *stage) finalName(file string) string {
+	return s.final + strings.TrimPrefix(file, s.temp)
+}
+
+// commit renames the temporary outputs to their final names and returns them.
+func (s *stage) commit() ([]string, error) {
+	var files []string
+	for _, file := range s.tempFiles() {
+		name := s.finalName(file)
+		if err := os.Rename(file, name); err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+func reportCommand(prog, cwd string, args []string, start time.Time, exitCode int, stderr string) {
+	emit(&Event{
+		Time:     time.Now(),
+		Action:   "run",
+		Command:  append([]string{prog}, args...),
+		Dir:      cwd,
+		Start:    &start,
+		ExitCode: &exitCode,
+		Stderr:   stderr,
+	})
+}
+
+// reportPackage ends the build of the current package.
+func reportPackage(start time.Time, ret int) {
+	e := &Event{Time: time.Now(), Action: "pass"}
+	e.Elapsed = e.Time.Sub(start).Seconds()
+
+	switch ret {
+	case 0:
+		if info, err := os.Stat(outputName); err == nil {
+			e.Artifacts = []Artifact{{outputName, info.Size()}}
+		}
+	case NoOutput:
+		e.Action = "skip"
+	default:
+		e.Action = "fail"
+	}
+	emit(e)
+}
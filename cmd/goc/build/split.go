@@ -0,0 +1,228 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/wasm2c"
+)
+
+var (
+	protoRegexp   = regexp.MustCompile(`^static [^=;{]*?\b(\w+)\([^;{]*\);\s*$`)
+	funcDefRegexp = regexp.MustCompile(`^static [^=;{]*?\b(\w+)\([^;{]*\)\s*\{\s*$`)
+	initDefRegexp = regexp.MustCompile(`^static void init_[a-z_]+\(void\)\s*\{\s*$`)
+	dataDefRegexp = regexp.MustCompile(`^static const u8 data_segment_data_\d+\[\] = \{\s*$`)
+	stateRegexp   = regexp.MustCompile(`\b(\w+)\s*(?:\[[^\]]*\])?\s*(?:=.*)?;\s*$`)
+)
+
+var errSplitFormat = errors.New("could not split C source: unexpected format")
+
+// splitCSource partitions the functions in the wasm2c output into n
+// translation units. Module state and function declarations are moved to a
+// shared header, the initialization code stays in the first unit. The shared
+// symbols are renamed with prefix and hidden, so a library does not export
+// them. Functions are recognized by their forward declarations, anything
+// else the split does not understand is an error and the file is compiled
+// as a single unit.
+func splitCSource(file string, n int, prefix string) ([]string, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var (
+		header, state, prelude, protos []string
+		pending, current               []string
+		funcs                          [][]string
+		names                          []string
+		declared                       = map[string]bool{}
+		renameAt                       = -1
+		inFunc, inInit, inData         bool
+	)
+
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if inFunc || inInit || inData {
+			current = append(current, line)
+			if line == "}" || (inData && line == "};") {
+				if inFunc {
+					funcs = append(funcs, current)
+				} else {
+					pending = append(pending, current...)
+				}
+				current = nil
+				inFunc, inInit, inData = false, false, false
+			}
+			continue
+		}
+
+		isStatic := strings.HasPrefix(line, "static ") && !strings.HasPrefix(line, "static inline ")
+		sm := funcDefRegexp.FindStringSubmatch(line)
+		switch {
+		case initDefRegexp.MatchString(line):
+			inInit = true
+			current = []string{line}
+		case dataDefRegexp.MatchString(line):
+			inData = true
+			current = []string{line}
+		case isStatic && sm != nil && declared[sm[1]]:
+			inFunc = true
+			current = []string{strings.TrimPrefix(line, "static ")}
+
+			// Only keep what is not blank lines between the functions.
+			for _, l := range pending {
+				if strings.TrimSpace(l) != "" {
+					prelude = append(prelude, l)
+				}
+			}
+			pending = nil
+		case isStatic && len(funcs) > 0:
+			// Helpers or state after the first function can not be shared.
+			return nil, errSplitFormat
+		case isStatic && protoRegexp.MatchString(line):
+			if renameAt < 0 {
+				renameAt = len(header)
+			}
+			name := protoRegexp.FindStringSubmatch(line)[1]
+			declared[name] = true
+			names = append(names, name)
+			protos = append(protos, "W2C_HIDDEN "+strings.TrimPrefix(line, "static "))
+		case isStatic && strings.HasSuffix(line, ";"):
+			// Module state, shared by all units and defined in the first.
+			decl := strings.TrimPrefix(line, "static ")
+			m := stateRegexp.FindStringSubmatch(decl)
+			if m == nil {
+				return nil, errSplitFormat
+			}
+			if renameAt < 0 {
+				renameAt = len(header)
+			}
+			names = append(names, m[1])
+
+			if i := strings.Index(decl, " = "); i > 0 {
+				header = append(header, "extern W2C_HIDDEN "+decl[:i]+";")
+			} else {
+				header = append(header, "extern W2C_HIDDEN "+decl)
+			}
+			state = append(state, decl)
+		case len(funcs) == 0:
+			header = append(header, line)
+		default:
+			pending = append(pending, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if inFunc || inInit || inData || len(funcs) < n || renameAt < 0 {
+		return nil, errSplitFormat
+	}
+	prelude = append(prelude, pending...)
+
+	// The shared names are renamed by the preprocessor, after the includes so system headers are not affected.
+	shared := []string{wasm2c.SharedPrelude}
+	for _, name := range names {
+		shared = append(shared, fmt.Sprintf("#define %s %s%s", name, prefix, name))
+	}
+	header = append(append(append(header[:renameAt:renameAt], shared...), header[renameAt:]...), protos...)
+
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	headerName := base + "_shared.h"
+	if err := writeLines(headerName, nil, header); err != nil {
+		return nil, err
+	}
+
+	include := fmt.Sprintf("#include \"%s\"\n", filepath.Base(headerName))
+	var init []string
+	init = append(init, state...)
+	init = append(init, "")
+	init = append(init, prelude...)
+
+	first := base + "_0.c"
+	if err := writeLines(first, []string{include}, init); err != nil {
+		return nil, err
+	}
+	files := []string{first}
+
+	var total int
+	for _, f := range funcs {
+		total += funcSize(f)
+	}
+
+	// Keep the original order and fill each unit up to an even share of the code.
+	var (
+		unit []string
+		size int
+	)
+	for i, f := range funcs {
+		unit = append(unit, f...)
+		unit = append(unit, "")
+		size += funcSize(f)
+
+		remaining := n - len(files)
+		if i == len(funcs)-1 || (remaining > 1 && size >= total/n) {
+			name := fmt.Sprintf("%s_%d.c", base, len(files))
+			if err := writeLines(name, []string{include}, unit); err != nil {
+				return nil, err
+			}
+			files = append(files, name)
+			unit, size = nil, 0
+		}
+	}
+	return files, nil
+}
+
+// symbolPrefix returns the prefix of the symbols shared between translation
+// units, -prefix or one made from the output name.
+func symbolPrefix() string {
+	if symPrefix != "" {
+		return symPrefix
+	}
+
+	name := strings.TrimSuffix(filepath.Base(outputName), filepath.Ext(outputName))
+	return "goc_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name) + "_"
+}
+
+func funcSize(lines []string) int {
+	var size int
+	for _, l := range lines {
+		size += len(l) + 1
+	}
+	return size
+}
+
+func writeLines(name string, head, lines []string) error {
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	w := bufio.NewWriter(fp)
+	w.WriteString("// Generated by the GopherC build tool.\n\n")
+	for _, l := range head {
+		w.WriteString(l + "\n")
+	}
+	for _, l := range lines {
+		w.WriteString(l + "\n")
+	}
+	return w.Flush()
+}
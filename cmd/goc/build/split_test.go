@@ -0,0 +1,224 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gopherc/goc/cmd/goc/internal/ctest"
+)
+
+// wabtOutput has the layout of wabt's wasm2c output, with a helper that is
+// not inline and defined before the module state.
+const wabtOutput = `#include <math.h>
+#include <string.h>
+
+#include "out.h"
+#define UNLIKELY(x) __builtin_expect(!!(x), 0)
+
+#define TRAP(x) (wasm_rt_trap(WASM_RT_TRAP_##x), 0)
+
+#define FUNC_PROLOGUE                                            \
+  if (++wasm_rt_call_stack_depth > WASM_RT_MAX_CALL_STACK_DEPTH) \
+    TRAP(EXHAUSTION)
+
+#define FUNC_EPILOGUE --wasm_rt_call_stack_depth
+
+static float quiet_nanf(float x) {
+  uint32_t tmp;
+  memcpy(&tmp, &x, 4);
+  tmp |= 0x7fc00000lu;
+  memcpy(&x, &tmp, 4);
+  return x;
+}
+
+static u32 func_types[1];
+
+static void init_func_types(void) {
+  func_types[0] = wasm_rt_register_func_type(1, 0, WASM_RT_I32);
+}
+
+static void f0(u32);
+static void run(u32, u32);
+static u32 getsp(void);
+
+static u32 g0;
+
+static void init_globals(void) {
+  g0 = 1024u;
+}
+
+static wasm_rt_memory_t M0;
+static wasm_rt_table_t T0;
+
+static void f0(u32 p0) {
+  FUNC_PROLOGUE;
+  M0.data[p0] = (u8)quiet_nanf(0.0f);
+  FUNC_EPILOGUE;
+}
+
+static void run(u32 p0, u32 p1) {
+  FUNC_PROLOGUE;
+  f0(getsp());
+  FUNC_EPILOGUE;
+}
+
+static u32 getsp(void) {
+  FUNC_PROLOGUE;
+  u32 i0;
+  i0 = g0;
+  FUNC_EPILOGUE;
+  return i0;
+}
+
+static const u8 data_segment_data_0[] = {
+  0x01, 0x02,
+};
+
+static void init_memory(void) {
+  wasm_rt_allocate_memory((&M0), 1, 65536);
+  memcpy(&(M0.data[2048u]), data_segment_data_0, 2);
+}
+
+static void init_table(void) {
+  uint32_t offset;
+  wasm_rt_allocate_table((&T0), 1, 1);
+  offset = 0u;
+  T0.data[offset + 0] = (wasm_rt_elem_t){func_types[0], (wasm_rt_anyfunc_t)(&f0)};
+}
+
+/* export: 'run' */
+void (*WASM_RT_ADD_PREFIX(Z_runZ_vii))(u32, u32);
+
+static void init_exports(void) {
+  WASM_RT_ADD_PREFIX(Z_runZ_vii) = (&run);
+}
+
+void WASM_RT_ADD_PREFIX(init)(void) {
+  init_func_types();
+  init_globals();
+  init_memory();
+  init_table();
+  init_exports();
+}
+`
+
+const wabtHeader = `#include <stdint.h>
+#include "wasm-rt.h"
+#define WASM_RT_ADD_PREFIX(x) x
+typedef uint8_t u8;
+typedef uint32_t u32;
+typedef uint64_t u64;
+extern void init(void);
+extern void (*Z_runZ_vii)(u32, u32);
+`
+
+func writeTestFile(t *testing.T, name, content string) {
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSplitWabt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cFile := filepath.Join(dir, "out.c")
+	writeTestFile(t, cFile, wabtOutput)
+	writeTestFile(t, filepath.Join(dir, "out.h"), wabtHeader)
+
+	files, err := splitCSource(cFile, 3, "pfx_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d units, want 3", len(files))
+	}
+
+	header := readTestFile(t, filepath.Join(dir, "out_shared.h"))
+	for _, want := range []string{
+		"#define run pfx_run",
+		"#define g0 pfx_g0",
+		"#define func_types pfx_func_types",
+		"extern W2C_HIDDEN u32 func_types[1];",
+		"extern W2C_HIDDEN wasm_rt_memory_t M0;",
+		"W2C_HIDDEN void run(u32, u32);",
+		"static float quiet_nanf(float x) {",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("shared header is missing %q", want)
+		}
+	}
+	if strings.Index(header, "#define run") < strings.Index(header, "#include \"out.h\"") {
+		t.Error("symbols are renamed before the includes")
+	}
+
+	first := readTestFile(t, files[0])
+	for _, want := range []string{"\nu32 g0;\n", "static void init_globals(void) {", "void WASM_RT_ADD_PREFIX(init)(void) {"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("first unit is missing %q", want)
+		}
+	}
+
+	var funcs int
+	for _, file := range files[1:] {
+		src := readTestFile(t, file)
+		funcs += strings.Count(src, "FUNC_PROLOGUE;")
+		if strings.Contains(src, "static void f0") || strings.Contains(src, "init_") {
+			t.Errorf("%s has static functions or initialization code", filepath.Base(file))
+		}
+	}
+	if funcs != 3 {
+		t.Errorf("got %d functions in the units, want 3", funcs)
+	}
+
+	ctest.Compile(t, dir, files...)
+}
+
+func TestSplitUnknownFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]string{
+		"helper after functions": wabtOutput + "\nstatic int helper(void) {\n  return 0;\n}\n",
+		"state after functions":  wabtOutput + "\nstatic u32 g1;\n",
+		"unterminated function":  wabtOutput[:strings.Index(wabtOutput, "  return i0;")],
+		"no declarations":        "static void f0(u32 p0) {\n}\n",
+	}
+	for name, src := range tests {
+		cFile := filepath.Join(dir, "out.c")
+		writeTestFile(t, cFile, src)
+		if _, err := splitCSource(cFile, 2, "pfx_"); err != errSplitFormat {
+			t.Errorf("%s: got %v, want %v", name, err, errSplitFormat)
+		}
+	}
+
+	// The build falls back to compiling the file as one unit.
+	writeTestFile(t, filepath.Join(dir, "out.c"), tests["helper after functions"])
+	oldJobs, oldTranslator := jobs, translator
+	defer func() { jobs, translator = oldJobs, oldTranslator }()
+	jobs, translator = 2, "wabt"
+	cFiles := []string{filepath.Join(dir, "out.c"), "goc-rt.c"}
+	if got := splitSources(cFiles); len(got) != 2 || got[0] != cFiles[0] {
+		t.Errorf("splitSources = %v, want %v", got, cFiles)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/cache"
+)
+
+// modulePrefix is added to the symbols of the wasm module in static libraries,
+// so the module init function and exports do not clash with the program.
+const modulePrefix = "goc_"
+
+// buildStatic builds the static library and its header, under the temporary output name of st.
+func buildStatic(st *stage, cFiles []string) error {
+	output := st.tempOutput(outputName)
+	headerName := strings.TrimSuffix(output, filepath.Ext(output)) + ".h"
+	cArgs := compileFlags()
+
+	// The include guard of the header is made from its name.
+	installName := filepath.Base(st.finalName(headerName))
+	compileKey, err := compileCacheKey(append(append([]string{"static", archiver, installName}, cArgs...), cFiles...), cFiles)
+	if err != nil {
+		return err
+	}
+
+	logln("Selected C compiler:", cCompiler)
+	if !forceBuild && cache.Get(compileKey, "output", output) && cache.Get(compileKey, "header", headerName) {
+		logln("Using cached C build:", compileKey)
+		st.cached = true
+		return nil
+	}
+
+	logln("Compiling C code...")
+	objects, err := compileObjects(cArgs, splitSources(cFiles))
+	if err != nil {
+		return err
+	}
+
+	logln("Creating static library...")
+	os.Remove(output)
+
+	ar := commandWords(archiver)
+	arArgs := append(ar[1:], toolchain.Archive(output)...)
+	if err := runProgram(ar[0], "", append(arArgs, objects...)...); err != nil {
+		return err
+	}
+
+	if err := writeHeader(headerName, installName); err != nil {
+		return err
+	}
+
+	putCacheFile(compileKey, "output", output)
+	putCacheFile(compileKey, "header", headerName)
+	return nil
+}
+
+// writeHeader writes the public interface of a static library, which is the
+// entry point. The include guard is made from the name the header is installed as.
+func writeHeader(name, installName string) error {
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	guard := "GOC_"
+	for _, c := range strings.ToUpper(installName) {
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			guard += string(c)
+		} else {
+			guard += "_"
+		}
+	}
+
+	fmt.Fprint(fp, "// Generated by the GopherC build tool.\n\n")
+	fmt.Fprintf(fp, "#ifndef %s\n#define %s\n\n", guard, guard)
+	fmt.Fprint(fp, "#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+
+	fmt.Fprint(fp, "/* Runs the Go program until it exits and returns the exit code. It is named\n")
+	fmt.Fprint(fp, "   with goc build -entry, goc_main by default, so it does not clash with main. */\n")
+	fmt.Fprintf(fp, "extern int %s(int argc, char *argv[]);\n\n", entryName)
+
+	fmt.Fprint(fp, "#ifdef __cplusplus\n}\n#endif\n\n")
+	fmt.Fprintf(fp, "#endif /* %s */\n", guard)
+	return nil
+}
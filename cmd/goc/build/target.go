@@ -0,0 +1,153 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Target describes the C toolchain used to build for a platform.
+type Target struct {
+	CC, AR string
+
+	// Syntax selects the toolchain driver, 'gcc', 'clang', 'msvc', 'tcc' or
+	// 'zig'. It is detected from the compiler when empty.
+	Syntax string
+
+	Sysroot         string
+	CFlags, LDFlags []string
+
+	// LibM links the math library explicitly.
+	LibM bool
+
+	ExeSuffix,
+	SharedSuffix,
+	StaticSuffix string
+}
+
+// compileFlags returns the target specific flags used when compiling.
+func (t *Target) compileFlags() []string {
+	var flags []string
+	if t.Sysroot != "" {
+		flags = append(flags, toolchain.Sysroot(t.Sysroot)...)
+	}
+	return append(flags, t.CFlags...)
+}
+
+// linkFlags returns the target specific flags that goes after the sources.
+func (t *Target) linkFlags() []string {
+	var flags []string
+	if t.LibM {
+		flags = append(flags, "-lm")
+	}
+	return append(flags, t.LDFlags...)
+}
+
+var target Target
+
+// setupTarget selects the toolchain either from the named profile or from the C compiler name.
+func setupTarget(inputPath string) error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if targetName == "" {
+		target = Target{CC: cCompiler, AR: archiver}
+	} else {
+		targets := map[string]Target{}
+		for _, file := range []string{filepath.Join(gocRoot, "goc.target"), filepath.Join(inputPath, "goc.target")} {
+			if err := loadTargets(file, targets); err != nil {
+				return err
+			}
+		}
+
+		t, ok := targets[targetName]
+		if !ok {
+			return fmt.Errorf("unknown target: %s", targetName)
+		}
+		target = t
+
+		if target.CC == "" || explicit["cc"] {
+			target.CC = cCompiler
+		}
+		if target.AR == "" || explicit["ar"] {
+			target.AR = archiver
+		}
+		cCompiler = target.CC
+	}
+
+	if err := setupToolchain(explicit["toolchain"] || configured["toolchain"]); err != nil {
+		return err
+	}
+
+	if target.AR == "" {
+		target.AR = toolchain.Archiver()
+	}
+	archiver = target.AR
+
+	if !explicit["o"] {
+		if suffix := outputSuffix(); suffix != "" {
+			outputName = "out" + suffix
+		}
+	}
+
+	// A library must not define main, it would clash with the program it is linked into.
+	if buildmode == "static" && !explicit["entry"] {
+		entryName = "goc_main"
+	}
+	return nil
+}
+
+// loadTargets decodes a target file, entries replaces already loaded targets with the same name.
+func loadTargets(file string, targets map[string]Target) error {
+	fp, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	logvln("Decode:", file)
+	var lst map[string]Target
+	if err := json.NewDecoder(fp).Decode(&lst); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	for name, t := range lst {
+		targets[name] = t
+	}
+	return nil
+}
+
+// setupToolchain selects the toolchain driver, by name if given with
+// -toolchain or the target, otherwise from the compiler version.
+func setupToolchain(explicit bool) error {
+	name := target.Syntax
+	if explicit {
+		name = toolchainName
+	}
+
+	if name == "" {
+		toolchain = detectToolchain(target.CC)
+	} else {
+		tc, err := findToolchain(name)
+		if err != nil {
+			return err
+		}
+		toolchain = tc
+		compilerBanner = versionBanner(target.CC)
+	}
+	toolchainName = toolchain.Name()
+
+	if targetName == "" {
+		target.LibM = toolchain.LibM()
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Toolchain is a driver for a family of C compilers, it knows how to build
+// the command lines for compiling, linking and archiving.
+type Toolchain interface {
+	// Name is the driver name, as selected with -toolchain or the target Syntax.
+	Name() string
+
+	// Detect reports if the compiler version banner belongs to this toolchain.
+	Detect(banner string) bool
+
+	// BaseFlags returns the flags every compile starts with.
+	BaseFlags() []string
+
+	Define(macro string) []string
+	Include(dir string) []string
+	Sysroot(dir string) []string
+
+	// Compile returns the flags that compiles src to the object file obj.
+	Compile(obj, src string) []string
+	ObjectSuffix() string
+
+	// Link returns the flags that names the executable or shared library.
+	Link(output string, shared bool) []string
+
+	// LinkFlags selects the compile flags that are repeated when linking objects.
+	LinkFlags(cFlags []string) []string
+	Library(name string) []string
+
+	// LinkerOptions arranges the translated flags that goes after the sources
+	// or objects, for compilers that want the linker options by themselves.
+	LinkerOptions(flags []string) []string
+
+	// LibM reports if the math library must be linked explicitly.
+	LibM() bool
+
+	// Incbin reports if the assembler can embed binary files with .incbin.
+	Incbin() bool
+
+	// Archiver is the default archiver, Archive returns its flags that goes before the objects.
+	Archiver() string
+	Archive(output string) []string
+	StaticSuffix() string
+
+	// TranslateFlags rewrites GCC style flags to the syntax of the toolchain.
+	TranslateFlags(flags []string) []string
+
+	// Depends returns the flags that lists the headers src includes, or nil if
+	// the compiler can not do that. ParseDepends reads the list from the output.
+	Depends(src string) []string
+	ParseDepends(output string) []string
+}
+
+// toolchains are the built-in drivers, in the order they are tried when detecting.
+var toolchains = []Toolchain{
+	msvcToolchain{},
+	zigToolchain{},
+	tccToolchain{},
+	clangToolchain{},
+	gccToolchain{},
+}
+
+var (
+	toolchain     Toolchain = gccToolchain{}
+	toolchainName string
+
+	// compilerBanner is the version output of the C compiler.
+	compilerBanner string
+)
+
+func findToolchain(name string) (Toolchain, error) {
+	for _, tc := range toolchains {
+		if tc.Name() == name {
+			return tc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown toolchain: %s", name)
+}
+
+// detectToolchain selects the driver from the version banner of cc. If the
+// compiler can not be run the driver is guessed from its name.
+func detectToolchain(cc string) Toolchain {
+	compilerBanner = versionBanner(cc)
+	for _, tc := range toolchains {
+		if compilerBanner != "" && tc.Detect(compilerBanner) {
+			logvln("Detected C toolchain:", tc.Name())
+			return tc
+		}
+	}
+
+	words := commandWords(cc)
+	baseName := strings.TrimSuffix(strings.ToLower(filepath.Base(words[0])), ".exe")
+	switch {
+	case baseName == "cl":
+		return msvcToolchain{}
+	case baseName == "zig":
+		return zigToolchain{}
+	case strings.Contains(baseName, "tcc"):
+		return tccToolchain{}
+	case strings.Contains(baseName, "clang"):
+		return clangToolchain{}
+	}
+	return gccToolchain{}
+}
+
+// versionBanner returns the output of 'cc --version', or of cc without
+// arguments for compilers like cl that prints their banner that way.
+func versionBanner(cc string) string {
+	words := commandWords(cc)
+	path, err := exec.LookPath(words[0])
+	if err != nil {
+		return ""
+	}
+
+	// The exit status is ignored since cl complains about the unknown option.
+	var output bytes.Buffer
+	cmd := exec.Command(path, append(words[1:], "--version")...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	runCommand(cmd)
+	if output.Len() == 0 {
+		cmd = exec.Command(path, words[1:]...)
+		cmd.Stdout, cmd.Stderr = &output, &output
+		runCommand(cmd)
+	}
+	return output.String()
+}
+
+// commandWords splits a command such as 'zig cc' into the program and its leading arguments.
+func commandWords(command string) []string {
+	words, err := splitArgs(command)
+	if err != nil || len(words) == 0 {
+		return []string{command}
+	}
+	return words
+}
+
+// runCompiler runs the C compiler command with args.
+func runCompiler(args ...string) error {
+	words := commandWords(cCompiler)
+	return runProgram(words[0], "", append(words[1:], args...)...)
+}
+
+type gccToolchain struct{}
+
+func (gccToolchain) Name() string {
+	return "gcc"
+}
+
+func (gccToolchain) Detect(banner string) bool {
+	return strings.Contains(banner, "Free Software Foundation") || strings.Contains(strings.ToLower(banner), "gcc")
+}
+
+func (gccToolchain) BaseFlags() []string {
+	return []string{"-std=c99"}
+}
+
+func (gccToolchain) Define(macro string) []string {
+	return []string{"-D" + macro}
+}
+
+func (gccToolchain) Include(dir string) []string {
+	return []string{"-I", dir}
+}
+
+func (gccToolchain) Sysroot(dir string) []string {
+	return []string{"--sysroot=" + dir}
+}
+
+func (gccToolchain) Compile(obj, src string) []string {
+	return []string{"-c", "-o", obj, src}
+}
+
+func (gccToolchain) ObjectSuffix() string {
+	return ".o"
+}
+
+func (gccToolchain) Link(output string, shared bool) []string {
+	if shared {
+		return []string{"-o", output, "-shared"}
+	}
+	return []string{"-o", output}
+}
+
+// LinkFlags keeps all flags since sanitizers and sysroot are needed when linking as well.
+func (gccToolchain) LinkFlags(cFlags []string) []string {
+	return cFlags
+}
+
+func (gccToolchain) Library(name string) []string {
+	return []string{"-l" + name}
+}
+
+func (gccToolchain) LinkerOptions(flags []string) []string {
+	return flags
+}
+
+func (gccToolchain) LibM() bool {
+	return true
+}
+
+func (gccToolchain) Incbin() bool {
+	return true
+}
+
+func (gccToolchain) Archiver() string {
+	return "ar"
+}
+
+func (gccToolchain) Archive(output string) []string {
+	return []string{"rcs", output}
+}
+
+func (gccToolchain) StaticSuffix() string {
+	return ".a"
+}
+
+func (gccToolchain) TranslateFlags(flags []string) []string {
+	return flags
+}
+
+// depsTarget is the make target of the dependency rule, it separates the rule from any warnings.
+const depsTarget = "goc-deps"
+
+func (gccToolchain) Depends(src string) []string {
+	return []string{"-MM", "-MT", depsTarget, src}
+}
+
+func (gccToolchain) ParseDepends(output string) []string {
+	output = strings.Replace(output, "\\\r\n", " ", -1)
+	output = strings.Replace(output, "\\\n", " ", -1)
+
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, depsTarget+":") {
+			continue
+		}
+
+		// Spaces in names are escaped with a backslash, other backslashes are Windows paths.
+		var name []byte
+		rule := line[len(depsTarget)+1:] + " "
+		for i := 0; i < len(rule); i++ {
+			switch c := rule[i]; {
+			case c == '\\' && i+1 < len(rule) && rule[i+1] == ' ':
+				name = append(name, ' ')
+				i++
+			case c == '$' && i+1 < len(rule) && rule[i+1] == '$':
+				name = append(name, '$')
+				i++
+			case c == ' ' || c == '\t' || c == '\r':
+				if len(name) > 0 {
+					files = append(files, string(name))
+					name = nil
+				}
+			default:
+				name = append(name, c)
+			}
+		}
+	}
+	return files
+}
+
+type clangToolchain struct {
+	gccToolchain
+}
+
+func (clangToolchain) Name() string {
+	return "clang"
+}
+
+func (clangToolchain) Detect(banner string) bool {
+	return strings.Contains(banner, "clang version") || strings.Contains(banner, "Apple LLVM")
+}
+
+func (clangToolchain) LibM() bool {
+	return false
+}
+
+type tccToolchain struct {
+	gccToolchain
+}
+
+func (tccToolchain) Name() string {
+	return "tcc"
+}
+
+func (tccToolchain) Detect(banner string) bool {
+	return strings.HasPrefix(banner, "tcc version")
+}
+
+func (tccToolchain) Incbin() bool {
+	return false
+}
+
+// Depends returns nil since tcc only writes dependencies as a side effect of compiling.
+func (tccToolchain) Depends(src string) []string {
+	return nil
+}
+
+// zigToolchain drives 'zig cc', which is clang with zig's own libc and cross compilation support.
+type zigToolchain struct {
+	gccToolchain
+}
+
+func (zigToolchain) Name() string {
+	return "zig"
+}
+
+func (zigToolchain) Detect(banner string) bool {
+	return strings.Contains(banner, "ziglang") || strings.Contains(banner, "zig-bootstrap")
+}
+
+func (zigToolchain) Archiver() string {
+	return "zig ar"
+}
+
+type msvcToolchain struct{}
+
+func (msvcToolchain) Name() string {
+	return "msvc"
+}
+
+func (msvcToolchain) Detect(banner string) bool {
+	return strings.Contains(banner, "Microsoft (R)")
+}
+
+func (msvcToolchain) BaseFlags() []string {
+	return []string{"/nologo"}
+}
+
+func (msvcToolchain) Define(macro string) []string {
+	return []string{"/D" + macro}
+}
+
+func (msvcToolchain) Include(dir string) []string {
+	return []string{"/I" + dir}
+}
+
+func (msvcToolchain) Sysroot(dir string) []string {
+	return nil
+}
+
+func (msvcToolchain) Compile(obj, src string) []string {
+	return []string{"/c", "/Fo" + obj, src}
+}
+
+func (msvcToolchain) ObjectSuffix() string {
+	return ".obj"
+}
+
+func (msvcToolchain) Link(output string, shared bool) []string {
+	if shared {
+		return []string{"/Fe" + output, "/LD"}
+	}
+	return []string{"/Fe" + output}
+}
+
+// LinkFlags keeps the flags cl needs when it links, the runtime library, debug
+// information and sanitizers.
+func (msvcToolchain) LinkFlags(cFlags []string) []string {
+	var flags []string
+	for _, f := range cFlags {
+		switch {
+		case f == "/nologo", f == "/Zi", f == "/Z7", strings.HasPrefix(f, "/fsanitize="):
+			flags = append(flags, f)
+		case f == "/MD", f == "/MDd", f == "/MT", f == "/MTd":
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
+
+func (msvcToolchain) Library(name string) []string {
+	if !strings.HasSuffix(strings.ToLower(name), ".lib") {
+		name += ".lib"
+	}
+	return []string{name}
+}
+
+// LinkerOptions keeps libraries and object files for cl and passes the
+// options to the linker after /link, which must be the last flag.
+func (msvcToolchain) LinkerOptions(flags []string) []string {
+	var files, options []string
+	for _, f := range flags {
+		if strings.HasPrefix(f, "/") || strings.HasPrefix(f, "-") {
+			options = append(options, f)
+		} else {
+			files = append(files, f)
+		}
+	}
+	if len(options) == 0 {
+		return files
+	}
+	return append(append(files, "/link"), options...)
+}
+
+func (msvcToolchain) LibM() bool {
+	return false
+}
+
+func (msvcToolchain) Incbin() bool {
+	return false
+}
+
+func (msvcToolchain) Archiver() string {
+	return "lib"
+}
+
+func (msvcToolchain) Archive(output string) []string {
+	return []string{"/nologo", "/OUT:" + output}
+}
+
+func (msvcToolchain) StaticSuffix() string {
+	return ".lib"
+}
+
+func (msvcToolchain) Depends(src string) []string {
+	return []string{"/showIncludes", "/Zs", src}
+}
+
+func (msvcToolchain) ParseDepends(output string) []string {
+	const note = "Note: including file:"
+
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, note) {
+			files = append(files, strings.TrimSpace(line[len(note):]))
+		}
+	}
+	return files
+}
+
+// msvcFlags maps GCC style flags to cl, an empty replacement drops the flag.
+var msvcFlags = map[string]string{
+	"-O0":      "/Od",
+	"-O1":      "/O1",
+	"-O2":      "/O2",
+	"-O3":      "/O2",
+	"-Os":      "/O1",
+	"-g":       "/Zi",
+	"-Wall":    "/W4",
+	"-w":       "/w",
+	"-Werror":  "/WX",
+	"-std=c99": "",
+	"-lm":      "",
+}
+
+func (msvcToolchain) TranslateFlags(flags []string) []string {
+	var result []string
+	for i := 0; i < len(flags); i++ {
+		f := flags[i]
+		if r, ok := msvcFlags[f]; ok {
+			if r != "" {
+				result = append(result, r)
+			}
+			continue
+		}
+
+		switch {
+		case (f == "-D" || f == "-I" || f == "-L") && i+1 < len(flags):
+			// The argument is the next word.
+			i++
+			result = append(result, msvcToolchain{}.TranslateFlags([]string{f + flags[i]})...)
+		case strings.HasPrefix(f, "-D") || strings.HasPrefix(f, "-I"):
+			result = append(result, "/"+f[1:])
+		case strings.HasPrefix(f, "-L") && len(f) > 2:
+			result = append(result, "/LIBPATH:"+f[2:])
+		case strings.HasPrefix(f, "-Wl,"):
+			for _, opt := range strings.Split(f[len("-Wl,"):], ",") {
+				if opt != "" {
+					result = append(result, opt)
+				}
+			}
+		case strings.HasPrefix(f, "-l") && len(f) > 2:
+			result = append(result, msvcToolchain{}.Library(f[2:])...)
+		default:
+			result = append(result, f)
+		}
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMSVCTranslateFlags(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{[]string{"-O2", "-g", "-std=c99", "-lm"}, []string{"/O2", "/Zi"}},
+		{[]string{"-DX=1", "-D", "Y", "-Iinc", "-I", "C:\\inc"}, []string{"/DX=1", "/DY", "/Iinc", "/IC:\\inc"}},
+		{[]string{"-lfoo", "-lbar.lib", "baz.lib"}, []string{"foo.lib", "bar.lib", "baz.lib"}},
+		{[]string{"-LC:\\lib", "-L", "lib"}, []string{"/LIBPATH:C:\\lib", "/LIBPATH:lib"}},
+		{[]string{"-Wl,/SUBSYSTEM:CONSOLE,/OPT:REF", "/MD"}, []string{"/SUBSYSTEM:CONSOLE", "/OPT:REF", "/MD"}},
+	}
+	for _, test := range tests {
+		if got := (msvcToolchain{}).TranslateFlags(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("TranslateFlags(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMSVCLinkerOptions(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{nil, nil},
+		{[]string{"foo.lib", "bar.obj"}, []string{"foo.lib", "bar.obj"}},
+		{
+			[]string{"/LIBPATH:lib", "foo.lib", "/DEBUG", "bar.lib"},
+			[]string{"foo.lib", "bar.lib", "/link", "/LIBPATH:lib", "/DEBUG"},
+		},
+	}
+	for _, test := range tests {
+		if got := (msvcToolchain{}).LinkerOptions(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("LinkerOptions(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	flags := []string{"-L", "lib", "-lfoo"}
+	if got := (gccToolchain{}).LinkerOptions(flags); !reflect.DeepEqual(got, flags) {
+		t.Errorf("gcc LinkerOptions(%q) = %q", flags, got)
+	}
+}
+
+func TestMSVCLinkFlags(t *testing.T) {
+	cFlags := []string{"/nologo", "/DGOC_ENTRY=main", "/Iruntime", "/O2", "/MT", "/Zi", "/fsanitize=address", "/W4"}
+	want := []string{"/nologo", "/MT", "/Zi", "/fsanitize=address"}
+	if got := (msvcToolchain{}).LinkFlags(cFlags); !reflect.DeepEqual(got, want) {
+		t.Errorf("LinkFlags(%q) = %q, want %q", cFlags, got, want)
+	}
+}
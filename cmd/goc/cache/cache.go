@@ -0,0 +1,171 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// MaxAge is how long an entry is kept after it was last used.
+	MaxAge = 5 * 24 * time.Hour
+
+	// trimInterval is how often Trim looks for unused entries.
+	trimInterval = 24 * time.Hour
+)
+
+// Hash accumulates the inputs of a build stage into a cache key.
+type Hash struct {
+	h hash.Hash
+}
+
+func NewHash(stage string) *Hash {
+	h := &Hash{sha256.New()}
+	h.String(stage)
+	return h
+}
+
+func (h *Hash) String(s string) {
+	fmt.Fprintf(h.h, "%d:%s\n", len(s), s)
+}
+
+func (h *Hash) File(path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	h.String(filepath.Base(path))
+	if _, err := io.Copy(h.h, fp); err != nil {
+		return err
+	}
+	fmt.Fprint(h.h, "\n")
+	return nil
+}
+
+func (h *Hash) Sum() string {
+	return hex.EncodeToString(h.h.Sum(nil))
+}
+
+// Dir returns the cache directory, GOCCACHE or the user cache directory.
+func Dir() string {
+	if dir := os.Getenv("GOCCACHE"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "goc-build")
+	}
+	return filepath.Join(os.TempDir(), "goc-build")
+}
+
+func entryPath(key, name string) string {
+	return filepath.Join(Dir(), key[:2], key, name)
+}
+
+// Get copies the cached file name for key to dest and reports if it was found.
+func Get(key, name, dest string) bool {
+	src := entryPath(key, name)
+	if _, err := os.Stat(src); err != nil {
+		return false
+	}
+	if copyFile(dest, src) != nil {
+		return false
+	}
+
+	// Mark the entry as used, the modification time is what Trim looks at.
+	now := time.Now()
+	os.Chtimes(filepath.Dir(src), now, now)
+	return true
+}
+
+// Put stores the file src under key with the given name.
+func Put(key, name, src string) error {
+	dest := entryPath(key, name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so concurrent builds never see a partial entry.
+	tmp := fmt.Sprintf("%s.%d.tmp", dest, os.Getpid())
+	if err := copyFile(tmp, src); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Clean removes the whole cache directory.
+func Clean() error {
+	return os.RemoveAll(Dir())
+}
+
+// Trim removes the entries that have not been used for maxAge. It does
+// nothing if the cache was trimmed within the last day, unless force is set.
+func Trim(maxAge time.Duration, force bool) error {
+	stamp := filepath.Join(Dir(), "trim.txt")
+	if info, err := os.Stat(stamp); err == nil && !force && time.Since(info.ModTime()) < trimInterval {
+		return nil
+	}
+
+	prefixes, err := ioutil.ReadDir(Dir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() {
+			continue
+		}
+		path := filepath.Join(Dir(), prefix.Name())
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.ModTime().Before(cutoff) {
+				if err := os.RemoveAll(filepath.Join(path, entry.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return ioutil.WriteFile(stamp, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644)
+}
+
+func copyFile(dest, src string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(destFile, srcFile); err != nil {
+		destFile.Close()
+		return err
+	}
+	return destFile.Close()
+}
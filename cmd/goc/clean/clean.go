@@ -0,0 +1,64 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package clean
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gopherc/goc/cmd/goc/cache"
+)
+
+func Clean() int {
+	setupFlags()
+	if !cleanCache && !trimCache {
+		fmt.Fprintln(os.Stderr, "nothing to clean, use -cache or -trim")
+		return -1
+	}
+
+	if !cleanCache {
+		if verbose {
+			fmt.Println("Trimming:", cache.Dir())
+		}
+		if err := cache.Trim(cache.MaxAge, true); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
+		return 0
+	}
+
+	if verbose {
+		fmt.Println("Removing:", cache.Dir())
+	}
+
+	if err := cache.Clean(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	return 0
+}
+
+func About() string {
+	return "remove cached build files"
+}
+
+var (
+	cleanCache,
+	trimCache,
+	verbose bool
+)
+
+func setupFlags() {
+	flag.BoolVar(&cleanCache, "cache", cleanCache, "remove the entire build cache")
+	flag.BoolVar(&trimCache, "trim", trimCache, "remove cache entries that have not been used for five days, goc build does this once a day")
+	flag.BoolVar(&verbose, "v", verbose, "verbose")
+	flag.Parse()
+}
+
+func PrintDefaults() {
+	setupFlags()
+	fmt.Println("goc clean [flags]")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+// Package config reads the per-project goc.json file. The file holds flag
+// defaults per command and per named profile, for example:
+//
+//	{
+//		"build": {"cc": "clang", "tags": "sdl"},
+//		"bind": {"prefix": "app_"},
+//		"profiles": {
+//			"debug": {"build": {"cflags": "-g -O0"}},
+//			"release": {"build": {"cflags": "-O3", "target": "linux-amd64-musl"}}
+//		}
+//	}
+//
+// Lists are joined by spaces, except for flags that can be repeated where
+// every item is set on its own. Flags given on the command line always take
+// precedence.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileName is the name of the project configuration file.
+const FileName = "goc.json"
+
+// listFlag is implemented by flag values that can be given multiple times.
+type listFlag interface {
+	IsListFlag() bool
+}
+
+// Find returns the path of the project file, searching from the working
+// directory up to the directory containing go.mod. It returns an empty string
+// if there is no project file.
+func Find() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		file := filepath.Join(dir, FileName)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return ""
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Apply sets the flags of command that were not given on the command line
+// from the project file, profile settings replace the command defaults.
+// It returns the names of the flags it set.
+func Apply(command, profile string) ([]string, error) {
+	file := Find()
+	if file == "" {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %s: no %s found", profile, FileName)
+		}
+		return nil, nil
+	}
+
+	values, err := load(file, command, profile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var applied []string
+	for name, items := range values {
+		if explicit[name] {
+			continue
+		}
+		f := flag.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("%s: unknown %s flag: %s", file, command, name)
+		}
+		if lf, ok := f.Value.(listFlag); !ok || !lf.IsListFlag() {
+			items = []string{strings.Join(items, " ")}
+		}
+		for _, value := range items {
+			if err := flag.Set(name, value); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", file, name, err)
+			}
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+func load(file, command, profile string) (map[string][]string, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var cfg map[string]json.RawMessage
+	if err := json.NewDecoder(fp).Decode(&cfg); err != nil {
+		return nil, err
+	}
+
+	values := map[string][]string{}
+	if err := decodeSection(cfg[command], values); err != nil {
+		return nil, fmt.Errorf("%s: %v", command, err)
+	}
+
+	if profile == "" {
+		return values, nil
+	}
+
+	var profiles map[string]map[string]json.RawMessage
+	if raw, ok := cfg["profiles"]; ok {
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return nil, fmt.Errorf("profiles: %v", err)
+		}
+	}
+
+	p, ok := profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s", profile)
+	}
+	if err := decodeSection(p[command], values); err != nil {
+		return nil, fmt.Errorf("profile %s: %s: %v", profile, command, err)
+	}
+	return values, nil
+}
+
+// decodeSection converts the flag values of a section to lists of strings.
+func decodeSection(raw json.RawMessage, values map[string][]string) error {
+	if raw == nil {
+		return nil
+	}
+
+	var section map[string]interface{}
+	if err := json.Unmarshal(raw, &section); err != nil {
+		return err
+	}
+
+	for name, v := range section {
+		switch v := v.(type) {
+		case string:
+			values[name] = []string{v}
+		case bool:
+			values[name] = []string{strconv.FormatBool(v)}
+		case float64:
+			values[name] = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("%s: lists can only hold strings", name)
+				}
+				items = append(items, s)
+			}
+			values[name] = items
+		default:
+			return fmt.Errorf("%s: invalid value", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package demangle
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gopherc/goc/cmd/goc/wasm2c"
+)
+
+// symbolPattern matches the symbols in filter mode, bind leaves unicode letters unescaped.
+var symbolPattern = regexp.MustCompile(`Z_[\p{L}\p{N}_]+`)
+
+func Demangle() int {
+	setupFlags()
+
+	convert := wasm2c.Demangle
+	if mangle {
+		convert = wasm2c.Mangle
+	}
+
+	if flag.NArg() > 0 {
+		ret := 0
+		for _, arg := range flag.Args() {
+			s, err := convert(arg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				ret = -1
+				continue
+			}
+			fmt.Println(s)
+		}
+		return ret
+	}
+
+	// Filter mode, like c++filt.
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1024*1024)
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if mangle {
+			if s, err := convert(line); err == nil && line != "" {
+				line = s
+			}
+		} else {
+			line = demangleLine(line)
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		w.Flush()
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	return 0
+}
+
+// demangleLine replaces the symbols in line, text that only looks like a symbol is left as is.
+func demangleLine(line string) string {
+	var result []byte
+	last := 0
+	for _, m := range symbolPattern.FindAllStringIndex(line, -1) {
+		// Plain names are too common in text, only symbols with a type are translated.
+		sym := line[m[0]:m[1]]
+		if strings.Count(sym, "Z_") < 2 {
+			continue
+		}
+
+		// Do not match in the middle of an identifier, but drop the underscore prefix of some linkers.
+		start := m[0]
+		if start > 0 && line[start-1] == '_' {
+			start--
+		}
+		if start > 0 {
+			r, _ := utf8.DecodeLastRuneInString(line[:start])
+			if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' {
+				continue
+			}
+		}
+
+		s, err := wasm2c.Demangle(sym)
+		if err != nil {
+			continue
+		}
+		result = append(result, line[last:start]...)
+		result = append(result, s...)
+		last = m[1]
+	}
+	return string(append(result, line[last:]...))
+}
+
+func About() string {
+	return "translate wasm2c symbol names to Go declarations"
+}
+
+var mangle bool
+
+func setupFlags() {
+	flag.BoolVar(&mangle, "mangle", mangle, "mangle declarations like 'go:runtime.wasmExit (i32) -> void' instead")
+	flag.Parse()
+}
+
+func PrintDefaults() {
+	setupFlags()
+	fmt.Println("goc demangle [-mangle] [symbols]")
+	fmt.Println("\nWithout arguments, the symbols found in stdin are translated.")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package doctor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/build"
+)
+
+func Doctor() int {
+	ret := 0
+	for _, c := range build.Diagnose() {
+		if c.Err == nil {
+			fmt.Printf("ok  \t%s\n", c.Name)
+			continue
+		}
+
+		ret = 1
+		fmt.Printf("FAIL\t%s\n", c.Name)
+		for _, line := range strings.Split(strings.TrimSpace(c.Err.Error()), "\n") {
+			fmt.Printf("    \t%s\n", line)
+		}
+		fmt.Printf("    \tfix: %s\n", c.Fix)
+	}
+	return ret
+}
+
+func About() string {
+	return "check the GopherC toolchain installation"
+}
+
+func PrintDefaults() {
+	fmt.Println("goc doctor [build flags]")
+	build.PrintFlags()
+}
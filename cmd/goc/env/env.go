@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gopherc/goc/cmd/goc/build"
+)
+
+func Env() int {
+	// -json selects the output format here, it is not the build event stream.
+	jsonOutput := false
+	args := []string{os.Args[0]}
+	for _, a := range os.Args[1:] {
+		if a == "-json" || a == "--json" {
+			jsonOutput = true
+			continue
+		}
+		args = append(args, a)
+	}
+	os.Args = args
+
+	settings, err := build.Settings()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(settings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, s := range settings {
+		status := ""
+		if s.Exists != nil {
+			status = "ok"
+			if !*s.Exists {
+				status = "missing"
+			}
+		}
+		fmt.Fprintf(w, "%s=%q\t%s\t%s\n", s.Name, s.Value, s.Source, status)
+	}
+	w.Flush()
+	return 0
+}
+
+func About() string {
+	return "print GopherC environment information"
+}
+
+func PrintDefaults() {
+	fmt.Println("goc env [-json] [build flags]")
+	fmt.Println("  -json\n    \tprint the settings as JSON")
+	build.PrintFlags()
+}
@@ -9,6 +9,13 @@ import (
 
 	"github.com/gopherc/goc/cmd/goc/bind"
 	"github.com/gopherc/goc/cmd/goc/build"
+	"github.com/gopherc/goc/cmd/goc/clean"
+	"github.com/gopherc/goc/cmd/goc/demangle"
+	"github.com/gopherc/goc/cmd/goc/doctor"
+	"github.com/gopherc/goc/cmd/goc/env"
+	"github.com/gopherc/goc/cmd/goc/run"
+	"github.com/gopherc/goc/cmd/goc/size"
+	"github.com/gopherc/goc/cmd/goc/test"
 	"github.com/gopherc/goc/cmd/goc/version"
 )
 
@@ -23,8 +30,13 @@ func main() {
 	i := 1
 	sz := 1
 	tool := os.Args[1]
+	passthrough := false
 	for _, a := range os.Args[2:] {
-		if a != "-h" {
+		// Arguments after -- belongs to the program started by goc run.
+		if a == "--" {
+			passthrough = true
+		}
+		if a != "-h" || passthrough {
 			os.Args[i] = a
 			sz++
 			i++
@@ -37,6 +49,20 @@ func main() {
 		os.Exit(bind.Bind())
 	case "build":
 		os.Exit(build.Build())
+	case "clean":
+		os.Exit(clean.Clean())
+	case "demangle":
+		os.Exit(demangle.Demangle())
+	case "doctor":
+		os.Exit(doctor.Doctor())
+	case "env":
+		os.Exit(env.Env())
+	case "run":
+		os.Exit(run.Run())
+	case "size":
+		os.Exit(size.Size())
+	case "test":
+		os.Exit(test.Test())
 	case "version":
 		fmt.Println("GopherC version:", version.Version)
 	case "help", "-help", "-h":
@@ -54,8 +80,8 @@ func main() {
 }
 
 func printHeader() {
-	fmt.Println("goc - GopherC compiler\nCopyright (C) 2016-2019 Andreas T Jonsson\n")
-	fmt.Println("You can run 'goc help [tool]' for more information of a specific tool.\n")
+	fmt.Print("goc - GopherC compiler\nCopyright (C) 2016-2019 Andreas T Jonsson\n\n")
+	fmt.Print("You can run 'goc help [tool]' for more information of a specific tool.\n\n")
 }
 
 func printToolHelp(tool string) {
@@ -64,6 +90,20 @@ func printToolHelp(tool string) {
 		bind.PrintDefaults()
 	case "build":
 		build.PrintDefaults()
+	case "clean":
+		clean.PrintDefaults()
+	case "demangle":
+		demangle.PrintDefaults()
+	case "doctor":
+		doctor.PrintDefaults()
+	case "env":
+		env.PrintDefaults()
+	case "run":
+		run.PrintDefaults()
+	case "size":
+		size.PrintDefaults()
+	case "test":
+		test.PrintDefaults()
 	default:
 		fmt.Println(tool, "has no options")
 	}
@@ -72,6 +112,13 @@ func printToolHelp(tool string) {
 func printTools() {
 	fmt.Println("\tbind\t" + bind.About())
 	fmt.Println("\tbuild\t" + build.About())
+	fmt.Println("\tclean\t" + clean.About())
+	fmt.Println("\tdemangle\t" + demangle.About())
+	fmt.Println("\tdoctor\t" + doctor.About())
+	fmt.Println("\tenv\t" + env.About())
 	fmt.Println("\thelp\tlist tools and options")
+	fmt.Println("\trun\t" + run.About())
+	fmt.Println("\tsize\t" + size.About())
+	fmt.Println("\ttest\t" + test.About())
 	fmt.Println("\tversion\t" + version.About())
 }
@@ -0,0 +1,37 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+// Package ctest has the helpers shared by the tests of the generated C code.
+package ctest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Compile compiles the C files with the system compiler, if there is one.
+// The runtime headers are found relative to the directory of a package in
+// cmd/goc, which is where go test runs its tests.
+func Compile(t testing.TB, dir string, files ...string) {
+	t.Helper()
+
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Log("no C compiler, skipping compile")
+		return
+	}
+	runtime, _ := filepath.Abs("../../../runtime")
+	if _, err := os.Stat(filepath.Join(runtime, "wasm-rt.h")); err != nil {
+		t.Log("no runtime headers, skipping compile")
+		return
+	}
+
+	for _, file := range files {
+		cmd := exec.Command(cc, "-std=c99", "-Werror=implicit-function-declaration", "-c", "-o", os.DevNull, "-I", runtime, "-I", dir, file)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", filepath.Base(file), err, out)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package run
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/gopherc/goc/cmd/goc/build"
+)
+
+func Run() int {
+	buildArgs := os.Args[1:]
+	var programArgs []string
+	for i, a := range buildArgs {
+		if a == "--" {
+			programArgs = buildArgs[i+1:]
+			buildArgs = buildArgs[:i]
+			break
+		}
+	}
+
+	// goc run decides where the program is built and it must be an executable.
+	for _, a := range buildArgs {
+		if name := flagName(a); name == "o" || name == "buildmode" {
+			fmt.Fprintf(os.Stderr, "goc run: -%s is not supported, use goc build\n", name)
+			return -1
+		}
+	}
+
+	tempPath, err := ioutil.TempDir("", "goc-run")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	defer os.RemoveAll(tempPath)
+
+	exe := filepath.Join(tempPath, "main")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+
+	// Build silently unless asked otherwise, flags given by the user comes last and takes precedence.
+	os.Args = append([]string{os.Args[0], "-s", "-o", exe}, buildArgs...)
+	build.DisableWatch = true
+	if ret := build.Build(); ret != 0 {
+		return ret
+	}
+
+	cmd := exec.Command(exe, programArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = build.OutputWriter()
+	cmd.Stderr = os.Stderr
+
+	// The program gets the interrupts from the terminal itself, goc waits for
+	// it to exit so the temporary directory is removed. Termination signals
+	// are forwarded to the program.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case s := <-sig:
+				if s == os.Interrupt {
+					continue
+				}
+				if err := cmd.Process.Signal(s); err != nil {
+					cmd.Process.Kill()
+				}
+			case <-exited:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	close(exited)
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			// The exit code is -1 when the program is stopped by a signal.
+			if code := exitErr.ExitCode(); code >= 0 {
+				return code
+			}
+			return build.ExitInterrupted
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	return 0
+}
+
+// flagName returns the name of a command line flag, like 'o' for '--o=file'.
+func flagName(a string) string {
+	if !strings.HasPrefix(a, "-") {
+		return ""
+	}
+	a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+	if i := strings.Index(a, "="); i >= 0 {
+		a = a[:i]
+	}
+	return a
+}
+
+func About() string {
+	return "compile and run GopherC application"
+}
+
+func PrintDefaults() {
+	fmt.Println("goc run [build flags] [input] -- [arguments]")
+	fmt.Println("\nThe program is always built as an executable in a temporary directory, so -o and")
+	fmt.Println("-buildmode are not accepted.")
+	fmt.Println()
+	build.PrintFlags()
+}
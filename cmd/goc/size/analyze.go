@@ -0,0 +1,319 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package size
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+	"github.com/gopherc/goc/cmd/goc/wasm2c"
+)
+
+const (
+	dataName  = "(data)"
+	otherName = "(other)"
+)
+
+var (
+	cFuncRegexp   = regexp.MustCompile(`^(?:static|W2C_HIDDEN) [^=;(]*\b(\w+)\(.*\)\s*\{\s*$`)
+	cDataRegexp   = regexp.MustCompile(`^static const u8 data_segment_data_\d+\[\] = \{\s*$`)
+	cDefineRegexp = regexp.MustCompile(`^#define (\w+) (\w+)\s*$`)
+	nativeRegexp  = regexp.MustCompile(`^(?:\w*?_)?w2c_f(\d+)(?:_\w*)?$`)
+)
+
+// cNames maps the C names of the translated functions to their index.
+type cNames struct {
+	// wabt has the names wabt gives the functions, see wabtNames. The
+	// native translator names them w2c_f<index>, with the prefix of split
+	// builds and the debug suffix.
+	wabt map[string]uint32
+
+	// renamed maps the symbols that are prefixed when goc build splits the
+	// wabt output in translation units to the names in the C code.
+	renamed map[string]string
+}
+
+func newCNames(m *wasm.Module, workPath string) (*cNames, error) {
+	n := &cNames{wabt: wabtNames(m), renamed: map[string]string{}}
+
+	fp, err := os.Open(filepath.Join(workPath, "out_shared.h"))
+	if os.IsNotExist(err) {
+		return n, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		if sm := cDefineRegexp.FindStringSubmatch(scanner.Text()); sm != nil {
+			n.renamed[sm[2]] = sm[1]
+		}
+	}
+	return n, scanner.Err()
+}
+
+// index returns the index of the function with the C name.
+func (n *cNames) index(name string) (uint32, bool) {
+	if original, ok := n.renamed[name]; ok {
+		name = original
+	}
+	if sm := nativeRegexp.FindStringSubmatch(name); sm != nil {
+		index, err := strconv.ParseUint(sm[1], 10, 32)
+		return uint32(index), err == nil
+	}
+	index, ok := n.wabt[name]
+	return index, ok
+}
+
+// symbolIndex returns the index of the function with the object file symbol,
+// which can have the underscore prefix of Mach-O and suffixes like '.constprop.0'.
+func (n *cNames) symbolIndex(sym string) (uint32, bool) {
+	if i := strings.Index(sym, "."); i > 0 {
+		sym = sym[:i]
+	}
+	if index, ok := n.index(sym); ok {
+		return index, true
+	}
+	if strings.HasPrefix(sym, "_") {
+		return n.index(sym[1:])
+	}
+	return 0, false
+}
+
+// wabtNames returns the names wabt's wasm2c gives the functions defined in m.
+// They are the names in the name section, or f<index>, with the characters
+// that are not valid in C replaced by '_'. Names that are already used, by the
+// imports or the functions before, get a '_<n>' suffix.
+func wabtNames(m *wasm.Module) map[string]uint32 {
+	used := map[string]bool{}
+	for _, imp := range m.Imports {
+		if imp.Kind == wasm.KindFunc {
+			used[wasm2c.MangleImport(imp.Module, imp.Name, m.Types[imp.Type])] = true
+		}
+	}
+
+	names := map[string]uint32{}
+	numImports := uint32(m.NumImportedFuncs())
+	for i := range m.Codes {
+		index := numImports + uint32(i)
+		name := m.FuncName(index)
+		if name == "" {
+			name = fmt.Sprintf("f%d", index)
+		}
+
+		legal := legalizeName(name)
+		if used[legal] {
+			base := legal + "_"
+			for n := 0; used[legal]; n++ {
+				legal = base + strconv.Itoa(n)
+			}
+		}
+		used[legal] = true
+		names[legal] = index
+	}
+	return names
+}
+
+// legalizeName makes a C identifier of name like wabt does, byte by byte.
+func legalizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	legal := []byte(name)
+	for i, c := range legal {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			legal[i] = '_'
+		}
+	}
+	return string(legal)
+}
+
+// analyze attributes the code in the work directory and the output of a build.
+func analyze(workPath, outputName string) (*Report, error) {
+	wasmFile := filepath.Join(workPath, "out.dce.wasm")
+	if _, err := os.Stat(wasmFile); err != nil {
+		wasmFile = filepath.Join(workPath, "out.wasm")
+	}
+	m, err := wasm.ReadFile(wasmFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("no wasm module was built, goc size expects a single package")
+		}
+		return nil, err
+	}
+
+	r := &Report{}
+	if info, err := os.Stat(outputName); err == nil && !info.IsDir() {
+		r.OutputSize = info.Size()
+	}
+
+	// The name section has the package paths mangled, use the names in the Go line table when possible.
+	goNames := wasm2c.GoNames(m)
+
+	numImports := uint32(m.NumImportedFuncs())
+	funcs := map[uint32]*Entry{}
+	for i, code := range m.Codes {
+		index := numImports + uint32(i)
+		name := m.FuncName(index)
+		if n, ok := goNames[name]; ok {
+			name = n
+		}
+		pkg := goPackage(name)
+		if name == "" {
+			name = fmt.Sprintf("f%d", index)
+			pkg = "(unnamed)"
+		}
+		funcs[index] = &Entry{Name: name, Package: pkg, Sizes: Sizes{Wasm: int64(len(code.Body))}}
+	}
+
+	data := &Entry{Name: dataName, Package: dataName}
+	for _, d := range m.Data {
+		data.Wasm += int64(len(d.Bytes))
+	}
+	other := &Entry{Name: otherName, Package: otherName}
+
+	names, err := newCNames(m, workPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The translation units of a parallel build are named out_1.c and so on.
+	units, err := filepath.Glob(filepath.Join(workPath, "out_*.c"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range append([]string{filepath.Join(workPath, "out.c")}, units...) {
+		if err := countCLines(file, names, funcs, data, other); err != nil {
+			return nil, err
+		}
+	}
+	r.Object = countObject(outputName, names, funcs, data, other)
+
+	packages := map[string]*Entry{}
+	add := func(e *Entry) {
+		r.Funcs = append(r.Funcs, *e)
+		p, ok := packages[e.Package]
+		if !ok {
+			p = &Entry{Name: e.Package}
+			packages[e.Package] = p
+		}
+		p.add(e.Sizes)
+		r.Total.add(e.Sizes)
+	}
+
+	for _, e := range funcs {
+		add(e)
+	}
+	add(data)
+	add(other)
+
+	for _, p := range packages {
+		r.Packages = append(r.Packages, *p)
+	}
+	return r, nil
+}
+
+// goPackage returns the import path of a Go symbol name, like 'github.com/a/b' for 'github.com/a/b.(*T).M'.
+func goPackage(name string) string {
+	s := name
+	if i := strings.Index(s, "["); i >= 0 {
+		// Type arguments can contain other import paths.
+		s = s[:i]
+	}
+
+	slash := strings.LastIndex(s, "/")
+	if dot := strings.Index(s[slash+1:], "."); dot > 0 {
+		return s[:slash+1+dot]
+	}
+	return "(no package)"
+}
+
+// countCLines counts the lines of each translated function in the wasm2c
+// output, the #line directives of debug builds are not counted.
+func countCLines(cFile string, names *cNames, funcs map[uint32]*Entry, data, other *Entry) error {
+	fp, err := os.Open(cFile)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	var current *Entry
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#line ") {
+			continue
+		}
+
+		if current == nil {
+			if cDataRegexp.MatchString(line) {
+				current = data
+			} else if sm := cFuncRegexp.FindStringSubmatch(line); sm != nil {
+				if index, ok := names.index(sm[1]); ok {
+					current = funcs[index]
+				}
+			}
+		}
+
+		if current == nil {
+			other.CLines++
+			continue
+		}
+		current.CLines++
+		if line == "}" || line == "};" {
+			current = nil
+		}
+	}
+	return scanner.Err()
+}
+
+// countObject reads the symbol sizes of the output with nm, it reports false
+// if the sizes are not available. Functions the C compiler inlined are not
+// visible and their code is counted where they were inlined.
+func countObject(outputName string, names *cNames, funcs map[uint32]*Entry, data, other *Entry) bool {
+	nm := os.Getenv("NM")
+	if nm == "" {
+		nm = "nm"
+	}
+
+	output, err := exec.Command(nm, "-P", outputName).Output()
+	if err != nil {
+		return false
+	}
+
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 16, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+
+		e := other
+		if index, ok := names.symbolIndex(fields[0]); ok && funcs[index] != nil {
+			e = funcs[index]
+		} else if strings.HasPrefix(strings.TrimPrefix(fields[0], "_"), "data_segment_data") {
+			e = data
+		}
+		e.Object += size
+		found = true
+	}
+	return found
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package size
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+	"github.com/gopherc/goc/cmd/goc/wasm2c"
+)
+
+// sizeModule returns a module with an import and four functions that call
+// it, two of them have names that are the same in C and one has no name.
+func sizeModule() *wasm.Module {
+	// call 0 (local.get 0)
+	call := []byte{0x20, 0x00, 0x10, 0x00, 0x0B}
+	return &wasm.Module{
+		Types:    []wasm.FuncType{{Params: []wasm.ValueType{wasm.I32}}},
+		Imports:  []wasm.Import{{Module: "go", Name: "debug", Kind: wasm.KindFunc, Type: 0}},
+		Funcs:    []uint32{0, 0, 0, 0},
+		Memories: []wasm.Memory{{Limits: wasm.Limits{Min: 1}}},
+		Exports:  []wasm.Export{{Name: "run", Kind: wasm.KindFunc, Index: 1}},
+		Codes:    []wasm.Code{{Body: call}, {Body: call}, {Body: call}, {Body: call}},
+		Names: map[uint32]string{
+			0: "go.debug",
+			1: "main.a.b",
+			2: "main.a_b",
+			4: "runtime.(*m).ok",
+		},
+	}
+}
+
+// wabtOutput is written like wabt's wasm2c translates sizeModule.
+const wabtOutput = `#include <math.h>
+#include <string.h>
+
+#include "out.h"
+
+static u32 func_types[1];
+
+static void init_func_types(void) {
+  func_types[0] = wasm_rt_register_func_type(1, 0, WASM_RT_I32);
+}
+
+static void main_a_b(u32);
+static void main_a_b_0(u32);
+static void f3(u32);
+static void runtime___m__ok(u32);
+
+static void main_a_b(u32 p0) {
+  FUNC_PROLOGUE;
+  u32 i0;
+  i0 = p0;
+  (*Z_goZ_debugZ_vi)(i0);
+  FUNC_EPILOGUE;
+}
+
+static void main_a_b_0(u32 p0) {
+  FUNC_PROLOGUE;
+  (*Z_goZ_debugZ_vi)(p0);
+  FUNC_EPILOGUE;
+}
+
+static void f3(u32 p0) {
+  (*Z_goZ_debugZ_vi)(p0);
+}
+
+static void runtime___m__ok(u32 p0) {
+}
+
+static const u8 data_segment_data_0[] = {
+  0x01, 0x02,
+};
+`
+
+func newEntries(m *wasm.Module) (map[uint32]*Entry, *Entry, *Entry) {
+	funcs := map[uint32]*Entry{}
+	for i := range m.Codes {
+		index := uint32(m.NumImportedFuncs() + i)
+		funcs[index] = &Entry{Name: m.FuncName(index)}
+	}
+	return funcs, &Entry{Name: dataName}, &Entry{Name: otherName}
+}
+
+func TestWabtNames(t *testing.T) {
+	want := map[string]uint32{
+		"main_a_b":        1,
+		"main_a_b_0":      2,
+		"f3":              3,
+		"runtime___m__ok": 4,
+	}
+	if got := wabtNames(sizeModule()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Names already used by the imports get a suffix.
+	m := sizeModule()
+	m.Names[3] = "Z_goZ_debugZ_vi"
+	if index := wabtNames(m)["Z_goZ_debugZ_vi_0"]; index != 3 {
+		t.Errorf("the function named like the import has index %d, want 3", index)
+	}
+}
+
+func TestCountCLinesWabt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cFile := filepath.Join(dir, "out.c")
+	if err := ioutil.WriteFile(cFile, []byte(wabtOutput), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := sizeModule()
+	names, err := newCNames(m, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs, data, other := newEntries(m)
+	if err := countCLines(cFile, names, funcs, data, other); err != nil {
+		t.Fatal(err)
+	}
+
+	for index, want := range map[uint32]int64{1: 7, 2: 5, 3: 3, 4: 2} {
+		if got := funcs[index].CLines; got != want {
+			t.Errorf("%s: got %d lines, want %d", funcs[index].Name, got, want)
+		}
+	}
+	if data.CLines != 3 {
+		t.Errorf("data: got %d lines, want 3", data.CLines)
+	}
+	if other.CLines != 20 {
+		t.Errorf("other: got %d lines, want 20", other.CLines)
+	}
+}
+
+func TestCountCLinesNative(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  wasm2c.Options
+	}{
+		{"single unit", wasm2c.Options{}},
+		{"debug", wasm2c.Options{Debug: true}},
+		{"units", wasm2c.Options{Units: 2, Prefix: "pfx_"}},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "goc-size")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		m := sizeModule()
+		wasmFile := filepath.Join(dir, "out.wasm")
+		cFile := filepath.Join(dir, "out.c")
+		if err := wasm.WriteFile(wasmFile, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := wasm2c.TranslateFile(wasmFile, cFile, test.opt); err != nil {
+			t.Fatal(err)
+		}
+
+		names, err := newCNames(m, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		units, err := filepath.Glob(filepath.Join(dir, "out_*.c"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		funcs, data, other := newEntries(m)
+		for _, file := range append([]string{cFile}, units...) {
+			if err := countCLines(file, names, funcs, data, other); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for index, e := range funcs {
+			if e.CLines == 0 {
+				t.Errorf("%s: no lines counted for function %d", test.name, index)
+			}
+		}
+
+		if test.opt.Prefix != "" {
+			if index, ok := names.symbolIndex("pfx_w2c_f2"); !ok || index != 2 {
+				t.Errorf("%s: pfx_w2c_f2 has index %d, %v", test.name, index, ok)
+			}
+		}
+	}
+}
+
+func TestSymbolIndex(t *testing.T) {
+	names := &cNames{
+		wabt:    wabtNames(sizeModule()),
+		renamed: map[string]string{"pfx_main_a_b": "main_a_b"},
+	}
+
+	tests := map[string]int{
+		"main_a_b":                1,
+		"_main_a_b":               1,
+		"pfx_main_a_b":            1,
+		"main_a_b_0.constprop.0":  2,
+		"_f3":                     3,
+		"w2c_f4":                  4,
+		"_w2c_f4_runtime___m__ok": 4,
+		"init_globals":            -1,
+		"data_segment_data_0":     -1,
+	}
+	for sym, want := range tests {
+		index, ok := names.symbolIndex(sym)
+		if want < 0 {
+			if ok {
+				t.Errorf("%s: got index %d, want none", sym, index)
+			}
+			continue
+		}
+		if !ok || index != uint32(want) {
+			t.Errorf("%s: got index %d, %v, want %d", sym, index, ok, want)
+		}
+	}
+}
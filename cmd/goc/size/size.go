@@ -0,0 +1,334 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package size
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gopherc/goc/cmd/goc/build"
+)
+
+// Sizes is the code attributed to a package or function. Object is zero
+// when the object code could not be measured.
+type Sizes struct {
+	Wasm, CLines, Object int64
+}
+
+func (s *Sizes) add(o Sizes) {
+	s.Wasm += o.Wasm
+	s.CLines += o.CLines
+	s.Object += o.Object
+}
+
+type Entry struct {
+	Name    string
+	Package string `json:",omitempty"`
+	Sizes
+
+	// Delta is the change from the previous build when diffing.
+	Delta *Sizes `json:",omitempty"`
+}
+
+// Report is the result of goc size, the JSON form can be diffed against later builds.
+type Report struct {
+	OutputSize int64
+	Object     bool
+	Total      Sizes
+	Packages   []Entry
+	Funcs      []Entry
+}
+
+func Size() int {
+	var (
+		buildArgs []string
+		outputName,
+		workPath,
+		sortKey,
+		diffFile string
+		top int
+		jsonOutput,
+		funcs bool
+	)
+
+	// Pick out the flags that belongs to goc size, the rest goes to goc build.
+	// -json selects the output format here, it is not the build event stream.
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := splitFlag(args[i])
+		switch name {
+		case "json":
+			jsonOutput = true
+			continue
+		case "funcs":
+			funcs = true
+			continue
+		case "sort", "diff", "n", "o", "work":
+		default:
+			buildArgs = append(buildArgs, args[i])
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "flag needs an argument: -"+name)
+				return -1
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "sort":
+			sortKey = value
+		case "diff":
+			diffFile = value
+		case "n":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				fmt.Fprintln(os.Stderr, "invalid value for -n:", value)
+				return -1
+			}
+			top = n
+		case "o":
+			outputName = value
+		case "work":
+			workPath = value
+		}
+	}
+
+	switch sortKey {
+	case "", "wasm", "c", "obj", "name":
+	default:
+		fmt.Fprintln(os.Stderr, "invalid sort key:", sortKey)
+		return -1
+	}
+
+	var previous *Report
+	if diffFile != "" {
+		var err error
+		if previous, err = readReport(diffFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
+	}
+
+	tempPath, err := ioutil.TempDir("", "goc-size")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	defer os.RemoveAll(tempPath)
+
+	if workPath == "" {
+		workPath = filepath.Join(tempPath, "work")
+	}
+	if outputName == "" {
+		outputName = filepath.Join(tempPath, "out")
+	}
+
+	os.Args = append([]string{os.Args[0], "-s", "-o", outputName, "-work", workPath}, buildArgs...)
+	build.DisableWatch = true
+	if ret := build.Build(); ret != 0 {
+		return ret
+	}
+
+	report, err := analyze(workPath, outputName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	if previous != nil {
+		report.diff(previous)
+	}
+
+	if sortKey == "" {
+		sortKey = "wasm"
+		if report.Object {
+			sortKey = "obj"
+		}
+	}
+	report.sort(sortKey)
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
+		return 0
+	}
+
+	entries := report.Packages
+	if funcs {
+		entries = report.Funcs
+	}
+	if top > 0 && top < len(entries) {
+		entries = entries[:top]
+	}
+	report.print(entries, funcs, previous != nil)
+	return 0
+}
+
+// splitFlag returns the name and value of a command line flag.
+func splitFlag(a string) (string, string, bool) {
+	if !strings.HasPrefix(a, "-") {
+		return "", "", false
+	}
+	a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+	if i := strings.Index(a, "="); i >= 0 {
+		return a[:i], a[i+1:], true
+	}
+	return a, "", false
+}
+
+func readReport(file string) (*Report, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return &r, nil
+}
+
+// diff sets the delta of every entry, entries that are gone are kept with zero size.
+func (r *Report) diff(previous *Report) {
+	r.Packages = diffEntries(r.Packages, previous.Packages)
+	r.Funcs = diffEntries(r.Funcs, previous.Funcs)
+}
+
+func diffEntries(entries, previous []Entry) []Entry {
+	old := map[string]Sizes{}
+	for _, e := range previous {
+		old[e.Name] = e.Sizes
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		o := old[e.Name]
+		e.Delta = &Sizes{e.Wasm - o.Wasm, e.CLines - o.CLines, e.Object - o.Object}
+		delete(old, e.Name)
+	}
+
+	for _, e := range previous {
+		if o, ok := old[e.Name]; ok {
+			entries = append(entries, Entry{Name: e.Name, Package: e.Package, Delta: &Sizes{-o.Wasm, -o.CLines, -o.Object}})
+		}
+	}
+	return entries
+}
+
+func (r *Report) sort(key string) {
+	value := func(e *Entry) int64 {
+		s := e.Sizes
+		if e.Delta != nil {
+			// Show the biggest changes first when diffing.
+			s = *e.Delta
+			if s.Wasm < 0 {
+				s.Wasm = -s.Wasm
+			}
+			if s.CLines < 0 {
+				s.CLines = -s.CLines
+			}
+			if s.Object < 0 {
+				s.Object = -s.Object
+			}
+		}
+
+		switch key {
+		case "c":
+			return s.CLines
+		case "obj":
+			return s.Object
+		}
+		return s.Wasm
+	}
+
+	for _, entries := range [][]Entry{r.Packages, r.Funcs} {
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := &entries[i], &entries[j]
+			if key != "name" {
+				if va, vb := value(a), value(b); va != vb {
+					return va > vb
+				}
+			}
+			return a.Name < b.Name
+		})
+	}
+}
+
+func (r *Report) print(entries []Entry, funcs, diff bool) {
+	column := "PACKAGE"
+	if funcs {
+		column = "FUNCTION"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	header := "WASM\tC LINES\t"
+	if r.Object {
+		header += "OBJECT\t"
+	}
+	fmt.Fprintln(w, header+" "+column)
+
+	row := func(name string, s Sizes, d *Sizes) {
+		line := formatSize(s.Wasm, d, func(d *Sizes) int64 { return d.Wasm }) + "\t"
+		line += formatSize(s.CLines, d, func(d *Sizes) int64 { return d.CLines }) + "\t"
+		if r.Object {
+			line += formatSize(s.Object, d, func(d *Sizes) int64 { return d.Object }) + "\t"
+		}
+		fmt.Fprintln(w, line+" "+name)
+	}
+
+	for _, e := range entries {
+		row(e.Name, e.Sizes, e.Delta)
+	}
+
+	var delta *Sizes
+	if diff {
+		delta = &Sizes{}
+		for _, e := range r.Packages {
+			delta.add(*e.Delta)
+		}
+	}
+	row("TOTAL", r.Total, delta)
+	w.Flush()
+
+	fmt.Printf("\nOutput size: %d bytes\n", r.OutputSize)
+	if !r.Object {
+		fmt.Println("Object code sizes are not available for this output.")
+	}
+}
+
+// formatSize formats v and, when diffing, the change selected from d.
+func formatSize(v int64, d *Sizes, field func(*Sizes) int64) string {
+	if d == nil {
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("%d (%+d)", v, field(d))
+}
+
+func About() string {
+	return "print the code size of packages and functions"
+}
+
+func PrintDefaults() {
+	fmt.Println("goc size [build flags] [-funcs] [-sort wasm|c|obj|name] [-n count] [-diff report.json] [-json] [package]")
+	fmt.Println("\nBuilds the package and attributes the wasm function bytes, generated C lines and")
+	fmt.Println("object code bytes to each Go package, or to each function with -funcs. The report")
+	fmt.Println("written with -json can be given to -diff in a later run to show what changed.")
+	fmt.Println()
+	build.PrintFlags()
+}
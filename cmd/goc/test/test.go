@@ -0,0 +1,126 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gopherc/goc/cmd/goc/build"
+)
+
+func Test() int {
+	var (
+		buildArgs,
+		testArgs []string
+		verbose bool
+	)
+
+	// Pick out the flags that belongs to the test binary, the rest goes to goc build.
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-v" || a == "--v":
+			verbose = true
+			testArgs = append(testArgs, "-test.v")
+		case a == "-run" || a == "--run":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "flag needs an argument: -run")
+				return -1
+			}
+			i++
+			testArgs = append(testArgs, "-test.run="+args[i])
+		case strings.HasPrefix(a, "-run=") || strings.HasPrefix(a, "--run="):
+			testArgs = append(testArgs, "-test.run="+a[strings.Index(a, "=")+1:])
+		default:
+			buildArgs = append(buildArgs, a)
+		}
+	}
+
+	tempPath, err := ioutil.TempDir("", "goc-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
+	defer os.RemoveAll(tempPath)
+
+	// Every package is built and tested on its own, Build resolves the
+	// packages with the build flags and calls testPackage after each build.
+	var built, failed bool
+	start := time.Now()
+	build.Built = func(importPath, dir, exe string, ret int) {
+		built = true
+		out := build.OutputWriter()
+		switch ret {
+		case 0:
+			failed = !testPackage(out, importPath, dir, exe, testArgs, verbose, start) || failed
+		case build.NoOutput:
+			fmt.Fprintf(out, "?   \t%s\t[no test files]\n", importPath)
+		default:
+			fmt.Fprintf(out, "FAIL\t%s [build failed]\n", importPath)
+			failed = true
+		}
+		start = time.Now()
+	}
+
+	build.Test = true
+	build.DisableWatch = true
+	os.Args = append([]string{os.Args[0], "-s", "-o", tempPath + string(filepath.Separator)}, buildArgs...)
+	switch ret := build.Build(); {
+	case ret == build.ExitInterrupted || ret == build.ExitTimeout:
+		return ret
+	case failed:
+		return 1
+	case !built:
+		return ret
+	}
+	return 0
+}
+
+// testPackage runs the test binary exe in the package directory, like go test,
+// writes the results to out and reports if the tests passed.
+func testPackage(out io.Writer, importPath, dir, exe string, testArgs []string, verbose bool, start time.Time) bool {
+	var output bytes.Buffer
+	cmd := exec.Command(exe, testArgs...)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	if verbose {
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+	} else {
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+	}
+
+	err := cmd.Run()
+	elapsed := time.Since(start).Seconds()
+	if err != nil {
+		out.Write(output.Bytes())
+		fmt.Fprintf(out, "FAIL\t%s\t%.3fs\n", importPath, elapsed)
+		return false
+	}
+
+	fmt.Fprintf(out, "ok  \t%s\t%.3fs\n", importPath, elapsed)
+	return true
+}
+
+func About() string {
+	return "test packages through the C pipeline"
+}
+
+func PrintDefaults() {
+	fmt.Println("goc test [build flags] [-run regexp] [-v] [packages]")
+	fmt.Println("\nEach package is built and its tests are run in the package directory, the")
+	fmt.Println("package in the current directory is tested by default.")
+	fmt.Println()
+	build.PrintFlags()
+}
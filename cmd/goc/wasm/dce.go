@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+import "fmt"
+
+// DCEReport describes the result of EliminateDeadCode.
+type DCEReport struct {
+	// Funcs is the number of defined functions before elimination.
+	Funcs int
+
+	// Removed lists the names of the removed functions, or their original index if they have no name.
+	Removed []string
+
+	// RemovedBytes is the total size of the removed function bodies.
+	RemovedBytes int
+
+	// TableEntries is the number of table entries that no longer refer to a live function.
+	TableEntries int
+}
+
+// EliminateDeadCode removes functions that can not be reached from the
+// exports, the start function or the table. Table entries are only
+// considered reachable if a live function performs a call_indirect with
+// a matching signature, other entries are pointed at a trapping stub.
+// Imported functions are always kept.
+func EliminateDeadCode(m *Module) (*DCEReport, error) {
+	numImports := uint32(m.NumImportedFuncs())
+	numFuncs := numImports + uint32(len(m.Funcs))
+	report := &DCEReport{Funcs: len(m.Funcs)}
+
+	for _, elem := range m.Elements {
+		for _, f := range elem.Funcs {
+			if f >= numFuncs {
+				return nil, fmt.Errorf("wasm: invalid table entry: %d", f)
+			}
+		}
+	}
+
+	typeIDs := make([]int, len(m.Types))
+	for i, ty := range m.Types {
+		typeIDs[i] = i
+		for j := 0; j < i; j++ {
+			if m.Types[j].Equal(ty) {
+				typeIDs[i] = j
+				break
+			}
+		}
+	}
+
+	live := make([]bool, numFuncs)
+	var work []uint32
+	mark := func(f uint32) {
+		if f < numFuncs && !live[f] {
+			live[f] = true
+			work = append(work, f)
+		}
+	}
+
+	indirect := map[int]bool{}
+	markTable := func(typeID int) {
+		if indirect[typeID] {
+			return
+		}
+		indirect[typeID] = true
+		for _, elem := range m.Elements {
+			for _, f := range elem.Funcs {
+				if typeIDs[m.funcTypeIndex(f)] == typeID {
+					mark(f)
+				}
+			}
+		}
+	}
+
+	for i := uint32(0); i < numImports; i++ {
+		mark(i)
+	}
+	for _, exp := range m.Exports {
+		switch exp.Kind {
+		case KindFunc:
+			mark(exp.Index)
+		case KindTable:
+			// The host can call anything in an exported table.
+			for _, elem := range m.Elements {
+				for _, f := range elem.Funcs {
+					mark(f)
+				}
+			}
+		}
+	}
+	if m.Start != nil {
+		mark(*m.Start)
+	}
+
+	for len(work) > 0 {
+		f := work[len(work)-1]
+		work = work[:len(work)-1]
+		if f < numImports {
+			continue
+		}
+
+		instrs, err := Decode(m.Codes[f-numImports].Body)
+		if err != nil {
+			return nil, fmt.Errorf("wasm: function %d: %v", f, err)
+		}
+		for _, in := range instrs {
+			switch in.Op {
+			case OpCall:
+				mark(uint32(in.Imm))
+			case OpCallIndirect:
+				if in.Imm < uint64(len(m.Types)) {
+					markTable(typeIDs[in.Imm])
+				}
+			}
+		}
+	}
+
+	// Build the new function index space.
+	remap := make([]uint32, numFuncs)
+	var (
+		funcs []uint32
+		codes []Code
+	)
+	next := numImports
+	for f := uint32(0); f < numFuncs; f++ {
+		if f < numImports {
+			remap[f] = f
+			continue
+		}
+
+		i := f - numImports
+		if !live[f] {
+			name := m.Names[f]
+			if name == "" {
+				name = fmt.Sprint(f)
+			}
+			report.Removed = append(report.Removed, name)
+			report.RemovedBytes += len(m.Codes[i].Body)
+			continue
+		}
+
+		remap[f] = next
+		funcs = append(funcs, m.Funcs[i])
+		codes = append(codes, m.Codes[i])
+		next++
+	}
+
+	if len(report.Removed) == 0 {
+		return report, nil
+	}
+
+	for i := range codes {
+		body, err := remapCalls(codes[i].Body, remap)
+		if err != nil {
+			return nil, err
+		}
+		codes[i].Body = body
+	}
+
+	// Dead table entries are pointed at a stub of the same signature that traps if called.
+	stubs := map[uint32]uint32{}
+	for i := range m.Elements {
+		elemFuncs := make([]uint32, len(m.Elements[i].Funcs))
+		for j, f := range m.Elements[i].Funcs {
+			if live[f] {
+				elemFuncs[j] = remap[f]
+				continue
+			}
+
+			ty := m.funcTypeIndex(f)
+			stub, ok := stubs[ty]
+			if !ok {
+				stub = next
+				stubs[ty] = stub
+				funcs = append(funcs, ty)
+				codes = append(codes, Code{Body: []byte{byte(OpUnreachable), byte(OpEnd)}})
+				next++
+			}
+			elemFuncs[j] = stub
+			report.TableEntries++
+		}
+		m.Elements[i].Funcs = elemFuncs
+	}
+
+	for i := range m.Exports {
+		if m.Exports[i].Kind == KindFunc {
+			m.Exports[i].Index = remap[m.Exports[i].Index]
+		}
+	}
+	if m.Start != nil {
+		start := remap[*m.Start]
+		m.Start = &start
+	}
+
+	names := map[uint32]string{}
+	for f, name := range m.Names {
+		if f < numFuncs && live[f] {
+			names[remap[f]] = name
+		}
+	}
+	for ty, stub := range stubs {
+		names[stub] = fmt.Sprintf("dce.stub%d", ty)
+	}
+
+	m.Funcs, m.Codes, m.Names = funcs, codes, names
+	return report, nil
+}
+
+// funcTypeIndex returns the type index of a function in the function index space.
+func (m *Module) funcTypeIndex(index uint32) uint32 {
+	if imp := m.ImportedFunc(index); imp != nil {
+		return imp.Type
+	}
+	return m.Funcs[index-uint32(m.NumImportedFuncs())]
+}
+
+// remapCalls returns a copy of body with the function index of every call replaced.
+func remapCalls(body []byte, remap []uint32) ([]byte, error) {
+	instrs, err := Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(body))
+	last := 0
+	for _, in := range instrs {
+		if in.Op != OpCall {
+			continue
+		}
+
+		// The immediate follows the opcode byte.
+		start := in.Pos + 1
+		_, n := readULEB(body[start:], 32)
+		out = append(out, body[last:start]...)
+		out = appendULEB(out, uint64(remap[in.Imm]))
+		last = start + n
+	}
+	return append(out, body[last:]...), nil
+}
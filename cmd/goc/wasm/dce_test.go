@@ -0,0 +1,157 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// dceModule returns a module with one import, an exported run function with
+// the given body and a table of functions with two different signatures.
+func dceModule(run []byte, exportTable bool) *Module {
+	m := &Module{
+		Types: []FuncType{
+			{Params: []ValueType{I32}},
+			{Results: []ValueType{I32}},
+			{Params: []ValueType{I32}}, // The same signature as type 0.
+			{Params: []ValueType{F64}},
+		},
+		Imports: []Import{{Module: "go", Name: "debug", Kind: KindFunc, Type: 0}},
+		Funcs:   []uint32{1, 0, 3, 0, 1, 0},
+		Tables:  []Table{{ElemType: 0x70, Limits: Limits{Min: 3}}},
+		Exports: []Export{{Name: "run", Kind: KindFunc, Index: 1}},
+		Elements: []Element{
+			{Offset: []byte{0x41, 0x00, 0x0B}, Funcs: []uint32{2, 3, 2}},
+		},
+		Codes: []Code{
+			{Body: run},
+			{Body: []byte{0x10, 0x05, 0x1A, 0x0B}}, // call 5, drop
+			{Body: []byte{0x0B}},
+			{Body: []byte{0x0B}},
+			{Body: []byte{0x41, 0x2A, 0x0B}},       // i32.const 42
+			{Body: []byte{0x10, 0x05, 0x1A, 0x0B}}, // call 5, drop
+		},
+		Names: map[uint32]string{
+			0: "go.debug",
+			1: "run",
+			2: "target",
+			3: "otherSig",
+			4: "dead",
+			5: "called",
+			6: "deadCaller",
+		},
+	}
+	if exportTable {
+		m.Exports = append(m.Exports, Export{Name: "table", Kind: KindTable, Index: 0})
+	}
+	return m
+}
+
+var (
+	// call_indirect (type 2) (i32.const 1) (i32.const 0), i32.const 0
+	callIndirect = []byte{0x41, 0x01, 0x41, 0x00, 0x11, 0x02, 0x00, 0x41, 0x00, 0x0B}
+	returnZero   = []byte{0x41, 0x00, 0x0B}
+)
+
+func TestEliminateDeadCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		run         []byte
+		exportTable bool
+
+		removed      []string
+		names        []string
+		elements     []uint32
+		tableEntries int
+	}{
+		{
+			name:         "call_indirect keeps the entries of its signature",
+			run:          callIndirect,
+			removed:      []string{"dead", "deadCaller", "otherSig"},
+			names:        []string{"go.debug", "run", "target", "called", "dce.stub3"},
+			elements:     []uint32{2, 4, 2},
+			tableEntries: 1,
+		},
+		{
+			name:         "table without call_indirect",
+			run:          returnZero,
+			removed:      []string{"called", "dead", "deadCaller", "otherSig", "target"},
+			names:        []string{"go.debug", "run", "dce.stub0", "dce.stub3"},
+			elements:     []uint32{2, 3, 2},
+			tableEntries: 3,
+		},
+		{
+			name:        "exported table",
+			run:         returnZero,
+			exportTable: true,
+			removed:     []string{"dead", "deadCaller"},
+			names:       []string{"go.debug", "run", "target", "otherSig", "called"},
+			elements:    []uint32{2, 3, 2},
+		},
+	}
+
+	for _, test := range tests {
+		m := dceModule(test.run, test.exportTable)
+		report, err := EliminateDeadCode(m)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		sort.Strings(report.Removed)
+		if !reflect.DeepEqual(report.Removed, test.removed) {
+			t.Errorf("%s: removed %v, want %v", test.name, report.Removed, test.removed)
+		}
+		if report.TableEntries != test.tableEntries {
+			t.Errorf("%s: %d table entries, want %d", test.name, report.TableEntries, test.tableEntries)
+		}
+
+		var names []string
+		for f := uint32(0); f < uint32(m.NumImportedFuncs()+len(m.Funcs)); f++ {
+			names = append(names, m.Names[f])
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: functions %v, want %v", test.name, names, test.names)
+		}
+		if got := m.Elements[0].Funcs; !reflect.DeepEqual(got, test.elements) {
+			t.Errorf("%s: table %v, want %v", test.name, got, test.elements)
+		}
+
+		// The table entries keep their signatures.
+		for i, f := range m.Elements[0].Funcs {
+			if want := dceModule(test.run, false).funcTypeIndex(uint32(i%2 + 2)); m.funcTypeIndex(f) != want {
+				t.Errorf("%s: table entry %d has type %d, want %d", test.name, i, m.funcTypeIndex(f), want)
+			}
+		}
+
+		if _, err := Read(m.Encode()); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestEliminateDeadCodeRemapsCalls(t *testing.T) {
+	m := dceModule(callIndirect, false)
+	if _, err := EliminateDeadCode(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// target calls called, which moved from index 5 to 3.
+	if want := []byte{0x10, 0x03, 0x1A, 0x0B}; !reflect.DeepEqual(m.Codes[1].Body, want) {
+		t.Errorf("got body %x, want %x", m.Codes[1].Body, want)
+	}
+	if m.Exports[0].Index != 1 {
+		t.Errorf("run moved to %d", m.Exports[0].Index)
+	}
+}
+
+func TestEliminateDeadCodeInvalidTable(t *testing.T) {
+	m := dceModule(returnZero, false)
+	m.Elements[0].Funcs = append(m.Elements[0].Funcs, 100)
+	if _, err := EliminateDeadCode(m); err == nil {
+		t.Error("no error for an invalid table entry")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Opcode of an instruction, the 0xFC prefixed instructions are stored as 0xFC00 | sub-opcode.
+type Opcode uint16
+
+const (
+	OpUnreachable  Opcode = 0x00
+	OpNop          Opcode = 0x01
+	OpBlock        Opcode = 0x02
+	OpLoop         Opcode = 0x03
+	OpIf           Opcode = 0x04
+	OpElse         Opcode = 0x05
+	OpEnd          Opcode = 0x0B
+	OpBr           Opcode = 0x0C
+	OpBrIf         Opcode = 0x0D
+	OpBrTable      Opcode = 0x0E
+	OpReturn       Opcode = 0x0F
+	OpCall         Opcode = 0x10
+	OpCallIndirect Opcode = 0x11
+	OpDrop         Opcode = 0x1A
+	OpSelect       Opcode = 0x1B
+	OpLocalGet     Opcode = 0x20
+	OpLocalSet     Opcode = 0x21
+	OpLocalTee     Opcode = 0x22
+	OpGlobalGet    Opcode = 0x23
+	OpGlobalSet    Opcode = 0x24
+	OpI32Load      Opcode = 0x28
+	OpI64Store32   Opcode = 0x3E
+	OpMemorySize   Opcode = 0x3F
+	OpMemoryGrow   Opcode = 0x40
+	OpI32Const     Opcode = 0x41
+	OpI64Const     Opcode = 0x42
+	OpF32Const     Opcode = 0x43
+	OpF64Const     Opcode = 0x44
+	OpI32Eqz       Opcode = 0x45
+	OpI64Extend32S Opcode = 0xC4
+
+	OpPrefix          Opcode = 0xFC
+	OpI32TruncSatF32S Opcode = 0xFC00
+	OpI64TruncSatF64U Opcode = 0xFC07
+	OpMemoryInit      Opcode = 0xFC08
+	OpDataDrop        Opcode = 0xFC09
+	OpMemoryCopy      Opcode = 0xFC0A
+	OpMemoryFill      Opcode = 0xFC0B
+)
+
+// BlockEmpty is the block type of blocks without a result.
+const BlockEmpty = 0x40
+
+// Instr is a decoded instruction.
+type Instr struct {
+	Op Opcode
+
+	// Imm is the index, constant bits or block type of the instruction.
+	Imm uint64
+
+	// Offset is the memory offset of loads and stores.
+	Offset uint32
+
+	// Targets of br_table, the last one is the default target.
+	Targets []uint32
+
+	// Pos is the byte offset of the instruction in the function body.
+	Pos int
+}
+
+// I32 returns the immediate of an i32.const.
+func (in *Instr) I32() int32 {
+	return int32(in.Imm)
+}
+
+// F32 returns the immediate of an f32.const.
+func (in *Instr) F32() float32 {
+	return math.Float32frombits(uint32(in.Imm))
+}
+
+// F64 returns the immediate of an f64.const.
+func (in *Instr) F64() float64 {
+	return math.Float64frombits(in.Imm)
+}
+
+// Decode decodes a function body or constant expression.
+func Decode(body []byte) ([]Instr, error) {
+	instrs, _, err := decode(body, false)
+	return instrs, err
+}
+
+// decode decodes instructions until the end of data, or the first top-level
+// end if single is set. It returns the instructions and number of bytes read.
+func decode(data []byte, single bool) ([]Instr, int, error) {
+	var (
+		instrs []Instr
+		depth  int
+	)
+
+	r := &reader{data: data}
+	for !r.eof() {
+		in := Instr{Pos: r.pos}
+		in.Op = Opcode(r.byte())
+
+		switch in.Op {
+		case OpBlock, OpLoop, OpIf:
+			depth++
+			bt := r.byte()
+			switch ValueType(bt) {
+			case BlockEmpty, I32, I64, F32, F64:
+			default:
+				return nil, 0, fmt.Errorf("unsupported block type: 0x%X", bt)
+			}
+			in.Imm = uint64(bt)
+		case OpEnd:
+			depth--
+		case OpBr, OpBrIf, OpCall, OpLocalGet, OpLocalSet, OpLocalTee, OpGlobalGet, OpGlobalSet:
+			in.Imm = uint64(r.u32())
+		case OpBrTable:
+			for n := r.u32(); n > 0 && r.err == nil; n-- {
+				in.Targets = append(in.Targets, r.u32())
+			}
+			in.Targets = append(in.Targets, r.u32())
+		case OpCallIndirect:
+			in.Imm = uint64(r.u32())
+			if table := r.byte(); table != 0 {
+				return nil, 0, errors.New("call_indirect: invalid table")
+			}
+		case OpMemorySize, OpMemoryGrow:
+			r.byte()
+		case OpI32Const:
+			v, n := readSLEB(r.data[r.pos:], 32)
+			if n == 0 {
+				return nil, 0, errors.New("i32.const: invalid integer")
+			}
+			in.Imm = uint64(uint32(int32(v)))
+			r.pos += n
+		case OpI64Const:
+			v, n := readSLEB(r.data[r.pos:], 64)
+			if n == 0 {
+				return nil, 0, errors.New("i64.const: invalid integer")
+			}
+			in.Imm = uint64(v)
+			r.pos += n
+		case OpF32Const:
+			b := r.bytes(4)
+			if len(b) == 4 {
+				in.Imm = uint64(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+			}
+		case OpF64Const:
+			b := r.bytes(8)
+			for i := len(b) - 1; i >= 0; i-- {
+				in.Imm = in.Imm<<8 | uint64(b[i])
+			}
+		case OpPrefix:
+			in.Op = OpPrefix<<8 | Opcode(r.u32())
+			switch in.Op {
+			case OpMemoryInit:
+				in.Imm = uint64(r.u32())
+				r.byte()
+			case OpDataDrop:
+				in.Imm = uint64(r.u32())
+			case OpMemoryCopy:
+				r.byte()
+				r.byte()
+			case OpMemoryFill:
+				r.byte()
+			default:
+				if in.Op > OpI64TruncSatF64U {
+					return nil, 0, fmt.Errorf("unsupported opcode: 0x%X", uint16(in.Op))
+				}
+			}
+		default:
+			switch {
+			case in.Op >= OpI32Load && in.Op <= OpI64Store32:
+				r.u32()
+				in.Offset = r.u32()
+			case in.Op == OpUnreachable || in.Op == OpNop || in.Op == OpElse || in.Op == OpReturn ||
+				in.Op == OpDrop || in.Op == OpSelect || (in.Op >= OpI32Eqz && in.Op <= OpI64Extend32S):
+			default:
+				return nil, 0, fmt.Errorf("unsupported opcode: 0x%X", uint16(in.Op))
+			}
+		}
+
+		if r.err != nil {
+			return nil, 0, r.err
+		}
+		instrs = append(instrs, in)
+
+		if depth < 0 {
+			if single {
+				return instrs, r.pos, nil
+			}
+			if !r.eof() {
+				return nil, 0, errors.New("instructions after function end")
+			}
+		}
+	}
+
+	if depth >= 0 {
+		return nil, 0, errors.New("missing end")
+	}
+	return instrs, r.pos, nil
+}
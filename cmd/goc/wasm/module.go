@@ -0,0 +1,222 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+// ValueType is the type of a WebAssembly value.
+type ValueType byte
+
+const (
+	I32 ValueType = 0x7F
+	I64 ValueType = 0x7E
+	F32 ValueType = 0x7D
+	F64 ValueType = 0x7C
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	}
+	return "unknown"
+}
+
+// ExternalKind is the kind of an import or export.
+type ExternalKind byte
+
+const (
+	KindFunc ExternalKind = iota
+	KindTable
+	KindMemory
+	KindGlobal
+)
+
+// Section ids.
+const (
+	SectionCustom = iota
+	SectionType
+	SectionImport
+	SectionFunction
+	SectionTable
+	SectionMemory
+	SectionGlobal
+	SectionExport
+	SectionStart
+	SectionElement
+	SectionCode
+	SectionData
+	SectionDataCount
+)
+
+type FuncType struct {
+	Params, Results []ValueType
+}
+
+// Equal reports if the two signatures are identical.
+func (t FuncType) Equal(o FuncType) bool {
+	if len(t.Params) != len(o.Params) || len(t.Results) != len(o.Results) {
+		return false
+	}
+	for i, p := range t.Params {
+		if o.Params[i] != p {
+			return false
+		}
+	}
+	for i, r := range t.Results {
+		if o.Results[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+type Limits struct {
+	Min, Max uint32
+	HasMax   bool
+}
+
+type Table struct {
+	ElemType byte
+	Limits   Limits
+}
+
+type Memory struct {
+	Limits Limits
+}
+
+type GlobalType struct {
+	Type    ValueType
+	Mutable bool
+}
+
+type Import struct {
+	Module, Name string
+	Kind         ExternalKind
+
+	// Type is the function type index for function imports.
+	Type   uint32
+	Table  Table
+	Memory Memory
+	Global GlobalType
+}
+
+type Global struct {
+	Type GlobalType
+
+	// Init is the constant initializer expression, including the end opcode.
+	Init []byte
+}
+
+type Export struct {
+	Name  string
+	Kind  ExternalKind
+	Index uint32
+}
+
+type Element struct {
+	Table  uint32
+	Offset []byte
+	Funcs  []uint32
+}
+
+type Data struct {
+	Memory  uint32
+	Passive bool
+	Offset  []byte
+	Bytes   []byte
+}
+
+type Local struct {
+	Count uint32
+	Type  ValueType
+}
+
+type Code struct {
+	Locals []Local
+
+	// Body is the function body instructions, including the final end opcode.
+	Body []byte
+}
+
+type Custom struct {
+	Name string
+	Data []byte
+}
+
+// Module is a decoded WebAssembly module.
+type Module struct {
+	Types    []FuncType
+	Imports  []Import
+	Funcs    []uint32
+	Tables   []Table
+	Memories []Memory
+	Globals  []Global
+	Exports  []Export
+	Start    *uint32
+	Elements []Element
+	Codes    []Code
+	Data     []Data
+	Customs  []Custom
+
+	// Names holds function names from the name section, by function index.
+	Names map[uint32]string
+}
+
+// NumImportedFuncs returns the number of imported functions, these comes first in the function index space.
+func (m *Module) NumImportedFuncs() int {
+	var n int
+	for _, imp := range m.Imports {
+		if imp.Kind == KindFunc {
+			n++
+		}
+	}
+	return n
+}
+
+// NumImportedGlobals returns the number of imported globals.
+func (m *Module) NumImportedGlobals() int {
+	var n int
+	for _, imp := range m.Imports {
+		if imp.Kind == KindGlobal {
+			n++
+		}
+	}
+	return n
+}
+
+// FuncType returns the signature of a function in the function index space.
+func (m *Module) FuncType(index uint32) FuncType {
+	for _, imp := range m.Imports {
+		if imp.Kind == KindFunc {
+			if index == 0 {
+				return m.Types[imp.Type]
+			}
+			index--
+		}
+	}
+	return m.Types[m.Funcs[index]]
+}
+
+// FuncName returns the debug name of a function or an empty string.
+func (m *Module) FuncName(index uint32) string {
+	return m.Names[index]
+}
+
+// ImportedFunc returns the import for a function index, or nil if it is defined in the module.
+func (m *Module) ImportedFunc(index uint32) *Import {
+	for i := range m.Imports {
+		if m.Imports[i].Kind == KindFunc {
+			if index == 0 {
+				return &m.Imports[i]
+			}
+			index--
+		}
+	}
+	return nil
+}
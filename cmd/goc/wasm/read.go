@@ -0,0 +1,389 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var magic = []byte{0x00, 0x61, 0x73, 0x6D, 0x01, 0x00, 0x00, 0x00}
+
+// ReadFile decodes the WebAssembly module in the named file.
+func ReadFile(name string) (*Module, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// Read decodes a WebAssembly module in the binary format.
+func Read(data []byte) (*Module, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, errors.New("wasm: invalid module header")
+	}
+
+	m := &Module{Names: map[uint32]string{}}
+	r := &reader{data: data, pos: len(magic)}
+
+	for !r.eof() {
+		id := r.byte()
+		size := r.u32()
+		if r.err != nil {
+			break
+		}
+
+		end := r.pos + int(size)
+		if end > len(data) {
+			return nil, errors.New("wasm: section out of bounds")
+		}
+		sr := &reader{data: data[:end], pos: r.pos}
+
+		switch id {
+		case SectionCustom:
+			readCustom(sr, m)
+		case SectionType:
+			readTypes(sr, m)
+		case SectionImport:
+			readImports(sr, m)
+		case SectionFunction:
+			for n := sr.u32(); n > 0 && sr.err == nil; n-- {
+				m.Funcs = append(m.Funcs, sr.u32())
+			}
+		case SectionTable:
+			for n := sr.u32(); n > 0 && sr.err == nil; n-- {
+				m.Tables = append(m.Tables, sr.table())
+			}
+		case SectionMemory:
+			for n := sr.u32(); n > 0 && sr.err == nil; n-- {
+				m.Memories = append(m.Memories, Memory{sr.limits()})
+			}
+		case SectionGlobal:
+			for n := sr.u32(); n > 0 && sr.err == nil; n-- {
+				ty := sr.globalType()
+				m.Globals = append(m.Globals, Global{ty, sr.constExpr()})
+			}
+		case SectionExport:
+			for n := sr.u32(); n > 0 && sr.err == nil; n-- {
+				m.Exports = append(m.Exports, Export{sr.name(), ExternalKind(sr.byte()), sr.u32()})
+			}
+		case SectionStart:
+			start := sr.u32()
+			m.Start = &start
+		case SectionElement:
+			readElements(sr, m)
+		case SectionCode:
+			readCodes(sr, m)
+		case SectionData:
+			readData(sr, m)
+		case SectionDataCount:
+			sr.u32()
+		default:
+			return nil, fmt.Errorf("wasm: unknown section: %d", id)
+		}
+
+		if sr.err != nil {
+			return nil, fmt.Errorf("wasm: section %d: %v", id, sr.err)
+		}
+		if id != SectionCustom && sr.pos != end {
+			return nil, fmt.Errorf("wasm: section %d: size mismatch", id)
+		}
+		r.pos = end
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(m.Funcs) != len(m.Codes) {
+		return nil, errors.New("wasm: function and code section mismatch")
+	}
+	return m, nil
+}
+
+func readCustom(r *reader, m *Module) {
+	name := r.name()
+	if r.err != nil {
+		return
+	}
+
+	data := r.data[r.pos:]
+	m.Customs = append(m.Customs, Custom{name, data})
+	if name != "name" {
+		return
+	}
+
+	// Names are only debug information, so ignore malformed subsections.
+	nr := &reader{data: data}
+	for !nr.eof() && nr.err == nil {
+		id := nr.byte()
+		size := nr.u32()
+		end := nr.pos + int(size)
+		if nr.err != nil || end > len(data) {
+			return
+		}
+
+		if id == 1 {
+			sr := &reader{data: data[:end], pos: nr.pos}
+			for n := sr.u32(); n > 0 && sr.err == nil; n-- {
+				idx := sr.u32()
+				name := sr.name()
+				if sr.err == nil {
+					m.Names[idx] = name
+				}
+			}
+		}
+		nr.pos = end
+	}
+}
+
+func readTypes(r *reader, m *Module) {
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		if form := r.byte(); form != 0x60 {
+			r.fail(fmt.Errorf("invalid function type: 0x%X", form))
+			return
+		}
+
+		var ty FuncType
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			ty.Params = append(ty.Params, r.valueType())
+		}
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			ty.Results = append(ty.Results, r.valueType())
+		}
+		m.Types = append(m.Types, ty)
+	}
+}
+
+func readImports(r *reader, m *Module) {
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		imp := Import{Module: r.name(), Name: r.name(), Kind: ExternalKind(r.byte())}
+		switch imp.Kind {
+		case KindFunc:
+			imp.Type = r.u32()
+		case KindTable:
+			imp.Table = r.table()
+		case KindMemory:
+			imp.Memory = Memory{r.limits()}
+		case KindGlobal:
+			imp.Global = r.globalType()
+		default:
+			r.fail(fmt.Errorf("invalid import kind: %d", imp.Kind))
+		}
+		m.Imports = append(m.Imports, imp)
+	}
+}
+
+func readElements(r *reader, m *Module) {
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		var elem Element
+		switch flags := r.u32(); flags {
+		case 0:
+			elem.Offset = r.constExpr()
+		case 2:
+			elem.Table = r.u32()
+			elem.Offset = r.constExpr()
+			if kind := r.byte(); kind != 0 {
+				r.fail(fmt.Errorf("unsupported element kind: %d", kind))
+			}
+		default:
+			r.fail(fmt.Errorf("unsupported element segment: %d", flags))
+			return
+		}
+
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			elem.Funcs = append(elem.Funcs, r.u32())
+		}
+		m.Elements = append(m.Elements, elem)
+	}
+}
+
+func readCodes(r *reader, m *Module) {
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		size := r.u32()
+		end := r.pos + int(size)
+		if r.err != nil || end > len(r.data) {
+			r.fail(errors.New("function body out of bounds"))
+			return
+		}
+
+		var code Code
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			code.Locals = append(code.Locals, Local{r.u32(), r.valueType()})
+		}
+
+		if r.pos > end {
+			r.fail(errors.New("function locals out of bounds"))
+			return
+		}
+		code.Body = r.data[r.pos:end]
+		m.Codes = append(m.Codes, code)
+		r.pos = end
+	}
+}
+
+func readData(r *reader, m *Module) {
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		var data Data
+		switch flags := r.u32(); flags {
+		case 0:
+			data.Offset = r.constExpr()
+		case 1:
+			data.Passive = true
+		case 2:
+			data.Memory = r.u32()
+			data.Offset = r.constExpr()
+		default:
+			r.fail(fmt.Errorf("unsupported data segment: %d", flags))
+			return
+		}
+		data.Bytes = r.bytes(int(r.u32()))
+		m.Data = append(m.Data, data)
+	}
+}
+
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) eof() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.fail(errors.New("unexpected end"))
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.data) {
+		r.fail(errors.New("unexpected end"))
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u32() uint32 {
+	v, n := readULEB(r.data[min(r.pos, len(r.data)):], 32)
+	if n <= 0 {
+		r.fail(errors.New("invalid integer"))
+		return 0
+	}
+	r.pos += n
+	return uint32(v)
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(int(r.u32())))
+}
+
+func (r *reader) valueType() ValueType {
+	t := ValueType(r.byte())
+	switch t {
+	case I32, I64, F32, F64:
+	default:
+		r.fail(fmt.Errorf("invalid value type: 0x%X", byte(t)))
+	}
+	return t
+}
+
+func (r *reader) limits() Limits {
+	var l Limits
+	flags := r.byte()
+	l.Min = r.u32()
+	if flags&1 != 0 {
+		l.HasMax = true
+		l.Max = r.u32()
+	}
+	return l
+}
+
+func (r *reader) table() Table {
+	return Table{r.byte(), r.limits()}
+}
+
+func (r *reader) globalType() GlobalType {
+	return GlobalType{r.valueType(), r.byte() != 0}
+}
+
+// constExpr reads a constant expression up to and including the end opcode.
+func (r *reader) constExpr() []byte {
+	start := r.pos
+	instrs, n, err := decode(r.data[start:], true)
+	if err != nil {
+		r.fail(err)
+		return nil
+	}
+	if len(instrs) == 0 || instrs[len(instrs)-1].Op != OpEnd {
+		r.fail(errors.New("invalid constant expression"))
+		return nil
+	}
+	r.pos += n
+	return r.data[start:r.pos]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// readULEB decodes an unsigned LEB128 number, the returned length is zero on failure.
+func readULEB(data []byte, bits uint) (uint64, int) {
+	var (
+		result uint64
+		shift  uint
+	)
+	for i, b := range data {
+		if shift >= bits+7 {
+			return 0, 0
+		}
+		result |= uint64(b&0x7F) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return result, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// readSLEB decodes a signed LEB128 number, the returned length is zero on failure.
+func readSLEB(data []byte, bits uint) (int64, int) {
+	var (
+		result int64
+		shift  uint
+	)
+	for i, b := range data {
+		if shift >= bits+7 {
+			return 0, 0
+		}
+		result |= int64(b&0x7F) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				result |= -1 << shift
+			}
+			return result, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// i32.const 1024, end
+var constExpr = []byte{0x41, 0x80, 0x08, 0x0B}
+
+func roundTripModules() map[string]*Module {
+	start := uint32(1)
+	return map[string]*Module{
+		"empty": {},
+		"imports": {
+			Types: []FuncType{{Params: []ValueType{I32}}},
+			Imports: []Import{
+				{Module: "go", Name: "debug", Kind: KindFunc, Type: 0},
+				{Module: "env", Name: "table", Kind: KindTable, Table: Table{ElemType: 0x70, Limits: Limits{Min: 1}}},
+				{Module: "env", Name: "mem", Kind: KindMemory, Memory: Memory{Limits{Min: 1, Max: 2, HasMax: true}}},
+				{Module: "env", Name: "sp", Kind: KindGlobal, Global: GlobalType{Type: I64, Mutable: true}},
+			},
+		},
+		"full": {
+			Types: []FuncType{
+				{Params: []ValueType{I32, I64}, Results: []ValueType{F64}},
+				{Results: []ValueType{F32}},
+				{},
+			},
+			Funcs:    []uint32{2, 0, 1},
+			Tables:   []Table{{ElemType: 0x70, Limits: Limits{Min: 3, Max: 3, HasMax: true}}, {ElemType: 0x70, Limits: Limits{Min: 1}}},
+			Memories: []Memory{{Limits{Min: 300}}},
+			Globals: []Global{
+				{Type: GlobalType{Type: I32, Mutable: true}, Init: constExpr},
+				{Type: GlobalType{Type: I64}, Init: []byte{0x42, 0x7F, 0x0B}},
+			},
+			Exports: []Export{
+				{Name: "run", Kind: KindFunc, Index: 0},
+				{Name: "mem", Kind: KindMemory, Index: 0},
+			},
+			Start: &start,
+			Elements: []Element{
+				{Offset: []byte{0x41, 0x00, 0x0B}, Funcs: []uint32{2, 1, 0}},
+				{Table: 1, Offset: []byte{0x41, 0x00, 0x0B}, Funcs: []uint32{1}},
+			},
+			Codes: []Code{
+				{Body: []byte{0x0B}},
+				{Locals: []Local{{Count: 2, Type: I32}, {Count: 200, Type: F64}}, Body: []byte{0x44, 0, 0, 0, 0, 0, 0, 0, 0, 0x0B}},
+				{Body: []byte{0x43, 0, 0, 0, 0, 0x0B}},
+			},
+			Data: []Data{
+				{Offset: constExpr, Bytes: []byte("hello")},
+				{Memory: 1, Offset: constExpr, Bytes: []byte{1}},
+				{Passive: true, Bytes: bytes.Repeat([]byte{0xFF}, 200)},
+			},
+			Customs: []Custom{{Name: "producers", Data: []byte{0, 1, 2}}},
+			Names:   map[uint32]string{0: "runtime.run", 2: "main.main"},
+		},
+	}
+}
+
+// normalize removes the differences that do not survive encoding, the name
+// section is regenerated from Names and Read always allocates Names.
+func normalize(m *Module) *Module {
+	n := *m
+	n.Customs = nil
+	for _, c := range m.Customs {
+		if c.Name != "name" {
+			n.Customs = append(n.Customs, c)
+		}
+	}
+	if len(n.Names) == 0 {
+		n.Names = nil
+	}
+	return &n
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, m := range roundTripModules() {
+		data := m.Encode()
+		got, err := Read(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(normalize(got), normalize(m)) {
+			t.Errorf("%s: got %+v, want %+v", name, normalize(got), normalize(m))
+		}
+		if again := got.Encode(); !bytes.Equal(again, data) {
+			t.Errorf("%s: encoding changed after a round-trip", name)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	valid := roundTripModules()["full"].Encode()
+
+	tests := map[string][]byte{
+		"no header":         []byte("\x00asm"),
+		"wrong version":     append([]byte{0x00, 0x61, 0x73, 0x6D, 0x02, 0x00, 0x00, 0x00}, valid[8:]...),
+		"truncated":         valid[:len(valid)/2],
+		"unknown section":   append(append([]byte{}, magic...), 0x20, 0x00),
+		"section too large": append(append([]byte{}, magic...), SectionType, 0x10, 0x00),
+		"missing code":      append(append([]byte{}, magic...), SectionFunction, 0x02, 0x01, 0x00),
+	}
+	for name, data := range tests {
+		if _, err := Read(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
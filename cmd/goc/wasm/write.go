@@ -0,0 +1,282 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+)
+
+// WriteFile encodes the module and writes it to the named file.
+func WriteFile(name string, m *Module) error {
+	return ioutil.WriteFile(name, m.Encode(), 0644)
+}
+
+// Encode returns the module in the binary format. Custom sections are
+// written last, the name section is regenerated from Names.
+func (m *Module) Encode() []byte {
+	w := &writer{}
+	w.Write(magic)
+
+	if len(m.Types) > 0 {
+		w.section(SectionType, func(s *writer) {
+			s.u32(uint32(len(m.Types)))
+			for _, ty := range m.Types {
+				s.WriteByte(0x60)
+				s.valueTypes(ty.Params)
+				s.valueTypes(ty.Results)
+			}
+		})
+	}
+
+	if len(m.Imports) > 0 {
+		w.section(SectionImport, func(s *writer) {
+			s.u32(uint32(len(m.Imports)))
+			for _, imp := range m.Imports {
+				s.name(imp.Module)
+				s.name(imp.Name)
+				s.WriteByte(byte(imp.Kind))
+				switch imp.Kind {
+				case KindFunc:
+					s.u32(imp.Type)
+				case KindTable:
+					s.table(imp.Table)
+				case KindMemory:
+					s.limits(imp.Memory.Limits)
+				case KindGlobal:
+					s.globalType(imp.Global)
+				}
+			}
+		})
+	}
+
+	if len(m.Funcs) > 0 {
+		w.section(SectionFunction, func(s *writer) {
+			s.u32(uint32(len(m.Funcs)))
+			for _, f := range m.Funcs {
+				s.u32(f)
+			}
+		})
+	}
+
+	if len(m.Tables) > 0 {
+		w.section(SectionTable, func(s *writer) {
+			s.u32(uint32(len(m.Tables)))
+			for _, t := range m.Tables {
+				s.table(t)
+			}
+		})
+	}
+
+	if len(m.Memories) > 0 {
+		w.section(SectionMemory, func(s *writer) {
+			s.u32(uint32(len(m.Memories)))
+			for _, mem := range m.Memories {
+				s.limits(mem.Limits)
+			}
+		})
+	}
+
+	if len(m.Globals) > 0 {
+		w.section(SectionGlobal, func(s *writer) {
+			s.u32(uint32(len(m.Globals)))
+			for _, g := range m.Globals {
+				s.globalType(g.Type)
+				s.Write(g.Init)
+			}
+		})
+	}
+
+	if len(m.Exports) > 0 {
+		w.section(SectionExport, func(s *writer) {
+			s.u32(uint32(len(m.Exports)))
+			for _, exp := range m.Exports {
+				s.name(exp.Name)
+				s.WriteByte(byte(exp.Kind))
+				s.u32(exp.Index)
+			}
+		})
+	}
+
+	if m.Start != nil {
+		w.section(SectionStart, func(s *writer) {
+			s.u32(*m.Start)
+		})
+	}
+
+	if len(m.Elements) > 0 {
+		w.section(SectionElement, func(s *writer) {
+			s.u32(uint32(len(m.Elements)))
+			for _, elem := range m.Elements {
+				if elem.Table == 0 {
+					s.u32(0)
+				} else {
+					s.u32(2)
+					s.u32(elem.Table)
+				}
+				s.Write(elem.Offset)
+				if elem.Table != 0 {
+					s.WriteByte(0)
+				}
+				s.u32(uint32(len(elem.Funcs)))
+				for _, f := range elem.Funcs {
+					s.u32(f)
+				}
+			}
+		})
+	}
+
+	passive := false
+	for _, data := range m.Data {
+		passive = passive || data.Passive
+	}
+	if passive {
+		w.section(SectionDataCount, func(s *writer) {
+			s.u32(uint32(len(m.Data)))
+		})
+	}
+
+	if len(m.Codes) > 0 {
+		w.section(SectionCode, func(s *writer) {
+			s.u32(uint32(len(m.Codes)))
+			for _, code := range m.Codes {
+				body := &writer{}
+				body.u32(uint32(len(code.Locals)))
+				for _, l := range code.Locals {
+					body.u32(l.Count)
+					body.WriteByte(byte(l.Type))
+				}
+				body.Write(code.Body)
+
+				s.u32(uint32(body.Len()))
+				s.Write(body.Bytes())
+			}
+		})
+	}
+
+	if len(m.Data) > 0 {
+		w.section(SectionData, func(s *writer) {
+			s.u32(uint32(len(m.Data)))
+			for _, data := range m.Data {
+				switch {
+				case data.Passive:
+					s.u32(1)
+				case data.Memory != 0:
+					s.u32(2)
+					s.u32(data.Memory)
+					s.Write(data.Offset)
+				default:
+					s.u32(0)
+					s.Write(data.Offset)
+				}
+				s.u32(uint32(len(data.Bytes)))
+				s.Write(data.Bytes)
+			}
+		})
+	}
+
+	for _, c := range m.Customs {
+		if c.Name == "name" {
+			continue
+		}
+		w.section(SectionCustom, func(s *writer) {
+			s.name(c.Name)
+			s.Write(c.Data)
+		})
+	}
+
+	if len(m.Names) > 0 {
+		w.section(SectionCustom, func(s *writer) {
+			s.name("name")
+
+			var indices []int
+			for idx := range m.Names {
+				indices = append(indices, int(idx))
+			}
+			sort.Ints(indices)
+
+			sub := &writer{}
+			sub.u32(uint32(len(indices)))
+			for _, idx := range indices {
+				sub.u32(uint32(idx))
+				sub.name(m.Names[uint32(idx)])
+			}
+
+			s.WriteByte(1)
+			s.u32(uint32(sub.Len()))
+			s.Write(sub.Bytes())
+		})
+	}
+
+	return w.Bytes()
+}
+
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) section(id byte, f func(s *writer)) {
+	s := &writer{}
+	f(s)
+	w.WriteByte(id)
+	w.u32(uint32(s.Len()))
+	w.Write(s.Bytes())
+}
+
+func (w *writer) u32(v uint32) {
+	w.Write(appendULEB(nil, uint64(v)))
+}
+
+func (w *writer) name(s string) {
+	w.u32(uint32(len(s)))
+	w.WriteString(s)
+}
+
+func (w *writer) valueTypes(types []ValueType) {
+	w.u32(uint32(len(types)))
+	for _, t := range types {
+		w.WriteByte(byte(t))
+	}
+}
+
+func (w *writer) limits(l Limits) {
+	if l.HasMax {
+		w.WriteByte(1)
+		w.u32(l.Min)
+		w.u32(l.Max)
+		return
+	}
+	w.WriteByte(0)
+	w.u32(l.Min)
+}
+
+func (w *writer) table(t Table) {
+	w.WriteByte(t.ElemType)
+	w.limits(t.Limits)
+}
+
+func (w *writer) globalType(g GlobalType) {
+	w.WriteByte(byte(g.Type))
+	if g.Mutable {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+// appendULEB appends v as an unsigned LEB128 number.
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm2c
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+)
+
+var typeNames = map[byte]string{
+	'i': "i32",
+	'j': "i64",
+	'f': "f32",
+	'd': "f64",
+}
+
+// Demangle turns a symbol created by MangleImport, MangleExport or MangleName
+// back into a declaration, like 'go:runtime.wasmExit (i32) -> void'. Exported
+// globals are written as 'name: i32'.
+func Demangle(symbol string) (string, error) {
+	parts, err := splitMangled(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(parts) {
+	case 1:
+		return parts[0], nil
+	case 2:
+		if t, ok := typeNames[parts[1][0]]; ok && len(parts[1]) == 1 {
+			return parts[0] + ": " + t, nil
+		}
+		sig, err := demangleSignature(parts[1])
+		if err != nil {
+			return "", err
+		}
+		return parts[0] + " " + sig, nil
+	case 3:
+		sig, err := demangleSignature(parts[2])
+		if err != nil {
+			return "", err
+		}
+		return parts[0] + ":" + parts[1] + " " + sig, nil
+	}
+	return "", fmt.Errorf("not a wasm2c symbol: %s", symbol)
+}
+
+// splitMangled decodes the names of a symbol, each name starts with 'Z_'.
+func splitMangled(symbol string) ([]string, error) {
+	if !strings.HasPrefix(symbol, "Z_") {
+		return nil, fmt.Errorf("not a wasm2c symbol: %s", symbol)
+	}
+
+	var (
+		parts []string
+		name  []byte
+	)
+	for i := 0; i < len(symbol); i++ {
+		c := symbol[i]
+		switch {
+		case c != 'Z':
+			name = append(name, c)
+		case i+1 < len(symbol) && symbol[i+1] == '_':
+			if i > 0 {
+				parts = append(parts, string(name))
+				name = nil
+			}
+			i++
+		case i+2 < len(symbol):
+			b, err := strconv.ParseUint(symbol[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape in %s: Z%s", symbol, symbol[i+1:i+3])
+			}
+			name = append(name, byte(b))
+			i += 2
+		default:
+			return nil, fmt.Errorf("not a wasm2c symbol: %s", symbol)
+		}
+	}
+	parts = append(parts, string(name))
+
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("not a wasm2c symbol: %s", symbol)
+		}
+	}
+	return parts, nil
+}
+
+// demangleSignature decodes the result and parameter types, Go only uses
+// functions with a single result so the first type is always the result.
+func demangleSignature(sig string) (string, error) {
+	if len(sig) < 2 {
+		return "", fmt.Errorf("invalid signature: %s", sig)
+	}
+
+	result := "void"
+	if sig[0] != 'v' {
+		t, ok := typeNames[sig[0]]
+		if !ok {
+			return "", fmt.Errorf("invalid signature: %s", sig)
+		}
+		result = t
+	}
+
+	var params []string
+	if sig[1:] != "v" {
+		for i := 1; i < len(sig); i++ {
+			t, ok := typeNames[sig[i]]
+			if !ok {
+				return "", fmt.Errorf("invalid signature: %s", sig)
+			}
+			params = append(params, t)
+		}
+	}
+	return fmt.Sprintf("(%s) -> %s", strings.Join(params, ", "), result), nil
+}
+
+// Mangle is the reverse of Demangle. It accepts 'module:name (params) -> result'
+// for imports, 'name (params) -> result' for exports, 'name: type' for
+// exported globals and a plain name for memories and tables.
+func Mangle(decl string) (string, error) {
+	decl = strings.TrimSpace(decl)
+	if decl == "" {
+		return "", errors.New("empty declaration")
+	}
+
+	open := strings.Index(decl, "(")
+	if open < 0 {
+		if i := strings.LastIndex(decl, ":"); i >= 0 {
+			t, err := parseValueType(decl[i+1:])
+			if err != nil {
+				return "", err
+			}
+			return MangleName(strings.TrimSpace(decl[:i])) + MangleName(typeChar(t)), nil
+		}
+		return MangleName(decl), nil
+	}
+
+	ty, err := parseFuncType(decl[open:])
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", decl, err)
+	}
+
+	name := strings.TrimSpace(decl[:open])
+	if name == "" {
+		return "", fmt.Errorf("%s: missing function name", decl)
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		return MangleImport(name[:i], name[i+1:], ty), nil
+	}
+	return MangleExport(name, ty), nil
+}
+
+// parseFuncType parses '(params) -> result', the result can be left out for void functions.
+func parseFuncType(s string) (wasm.FuncType, error) {
+	var ty wasm.FuncType
+	end := strings.Index(s, ")")
+	if end < 0 {
+		return ty, errors.New("missing ')'")
+	}
+
+	if params := strings.TrimSpace(s[1:end]); params != "" && params != "void" {
+		for _, p := range strings.Split(params, ",") {
+			t, err := parseValueType(p)
+			if err != nil {
+				return ty, err
+			}
+			ty.Params = append(ty.Params, t)
+		}
+	}
+
+	rest := strings.TrimSpace(s[end+1:])
+	if rest == "" {
+		return ty, nil
+	}
+	if !strings.HasPrefix(rest, "->") {
+		return ty, fmt.Errorf("unexpected %q", rest)
+	}
+	if result := strings.TrimSpace(rest[2:]); result != "void" {
+		t, err := parseValueType(result)
+		if err != nil {
+			return ty, err
+		}
+		ty.Results = []wasm.ValueType{t}
+	}
+	return ty, nil
+}
+
+func parseValueType(s string) (wasm.ValueType, error) {
+	switch strings.TrimSpace(s) {
+	case "i32":
+		return wasm.I32, nil
+	case "i64":
+		return wasm.I64, nil
+	case "f32":
+		return wasm.F32, nil
+	case "f64":
+		return wasm.F64, nil
+	}
+	return 0, fmt.Errorf("unknown type: %s", strings.TrimSpace(s))
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm2c
+
+import "testing"
+
+func TestMangleRoundTrip(t *testing.T) {
+	tests := []struct {
+		decl, symbol string
+	}{
+		{"go:runtime.wasmExit (i32) -> void", "Z_goZ_runtimeZ2EwasmExitZ_vi"},
+		{"go:syscall/js.valueGet (i32) -> void", "Z_goZ_syscallZ2FjsZ2EvalueGetZ_vi"},
+		{"env:sqrt (f64, f32, i64) -> f64", "Z_envZ_sqrtZ_ddfj"},
+		{"run (i32, i32) -> void", "Z_runZ_vii"},
+		{"getsp () -> i32", "Z_getspZ_iv"},
+		{"resume () -> void", "Z_resumeZ_vv"},
+		{"mem", "Z_mem"},
+		{"sp: i64", "Z_spZ_j"},
+		{"Zeta", "Z_Z5Aeta"},
+		{"a_b", "Z_a_b"},
+		{"main.Zero", "Z_mainZ2EZ5Aero"},
+	}
+
+	for _, test := range tests {
+		symbol, err := Mangle(test.decl)
+		if err != nil {
+			t.Errorf("Mangle(%q): %v", test.decl, err)
+			continue
+		}
+		if symbol != test.symbol {
+			t.Errorf("Mangle(%q) = %q, want %q", test.decl, symbol, test.symbol)
+		}
+
+		decl, err := Demangle(symbol)
+		if err != nil {
+			t.Errorf("Demangle(%q): %v", symbol, err)
+			continue
+		}
+		if decl != test.decl {
+			t.Errorf("Demangle(%q) = %q, want %q", symbol, decl, test.decl)
+		}
+	}
+}
+
+func TestMangleNameRoundTrip(t *testing.T) {
+	names := []string{
+		"runtime.main",
+		"internal/abi.(*Type).Kind",
+		"Z",
+		"ZZ_",
+		"_Z2E_",
+		"with space",
+		"unicode.Ünïcode",
+		"sync/atomic.(*Value).Store-fm",
+	}
+	for _, name := range names {
+		symbol := MangleName(name)
+		parts, err := splitMangled(symbol)
+		if err != nil {
+			t.Errorf("%q: %v", symbol, err)
+			continue
+		}
+		if len(parts) != 1 || parts[0] != name {
+			t.Errorf("MangleName(%q) = %q, which decodes to %q", name, symbol, parts)
+		}
+	}
+}
+
+func TestDemangleErrors(t *testing.T) {
+	symbols := []string{
+		"",
+		"main",
+		"Z_",
+		"Z_aZ_",
+		"Z_aZ",
+		"Z_aZ2",
+		"Z_aZXY",
+		"Z_aZ_x",
+		"Z_aZ_vq",
+		"Z_aZ_bZ_cZ_d",
+	}
+	for _, symbol := range symbols {
+		if decl, err := Demangle(symbol); err == nil {
+			t.Errorf("Demangle(%q) = %q, want an error", symbol, decl)
+		}
+	}
+}
+
+func TestMangleErrors(t *testing.T) {
+	decls := []string{
+		"",
+		" ",
+		"f (i32",
+		"f (i8) -> void",
+		"f (i32) i32",
+		"f (i32) -> u8",
+		"(i32) -> void",
+		"sp: i16",
+	}
+	for _, decl := range decls {
+		if symbol, err := Mangle(decl); err == nil {
+			t.Errorf("Mangle(%q) = %q, want an error", decl, symbol)
+		}
+	}
+}
@@ -0,0 +1,830 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm2c
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+)
+
+// Values on the operand stack are kept in temporaries named by type and stack
+// depth, so a block result always ends up in the same variable regardless of
+// which branch produced it. Control flow is lowered to labels and gotos.
+
+type frame struct {
+	op      wasm.Opcode
+	result  wasm.ValueType
+	height  int
+	label   int
+	live    bool
+	used    bool
+	hasElse bool
+}
+
+type function struct {
+	t      *translator
+	sb     strings.Builder
+	locals []wasm.ValueType
+	stack  []wasm.ValueType
+	frames []frame
+	temps  map[string]wasm.ValueType
+	labels int
+	live   bool
+	lines  *funcLines
+}
+
+// funcLines tracks the Go source position of a function in debug mode.
+type funcLines struct {
+	name   string
+	starts []int
+
+	// dispatch is the number of instructions that selects the resume block,
+	// outer is the number of blocks around the resume blocks and open is the
+	// number of resume blocks that are not yet closed.
+	dispatch,
+	outer,
+	open int
+
+	// The Go source position of the code that follows, the file is written
+	// with the first directive after it changes.
+	file      string
+	line      int
+	fileDirty bool
+}
+
+func (t *translator) writeFunction(index uint32, code *wasm.Code) error {
+	ty := t.m.FuncType(index)
+	f := &function{t: t, temps: make(map[string]wasm.ValueType), live: true}
+
+	f.locals = append(f.locals, ty.Params...)
+	for _, l := range code.Locals {
+		for i := uint32(0); i < l.Count; i++ {
+			f.locals = append(f.locals, l.Type)
+		}
+	}
+
+	var result wasm.ValueType
+	if len(ty.Results) > 0 {
+		result = ty.Results[0]
+	}
+	f.frames = append(f.frames, frame{result: result, live: true})
+
+	instrs, err := wasm.Decode(code.Body)
+	if err != nil {
+		return err
+	}
+
+	if t.lines != nil {
+		starts, n, outer := resumePoints(instrs)
+		f.lines = &funcLines{name: t.m.FuncName(index), starts: starts, dispatch: n, outer: outer, open: len(starts)}
+		f.lineDirective(0)
+	}
+
+	for i := range instrs {
+		in := &instrs[i]
+		if f.lines != nil && i >= f.lines.dispatch && in.Op == wasm.OpCall {
+			f.callLine()
+		}
+		if err := f.instr(in); err != nil {
+			return fmt.Errorf("offset 0x%X: %v", in.Pos, err)
+		}
+		if f.lines != nil && i >= f.lines.dispatch && in.Op == wasm.OpEnd {
+			f.resumeLine()
+		}
+	}
+
+	var params []string
+	for i, p := range ty.Params {
+		params = append(params, fmt.Sprintf("%s l%d", cType(p), i))
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+
+	name := t.funcName(index)
+	if n := t.m.FuncName(index); n != "" {
+		fmt.Fprintf(t.c, "/* %s */\n", strings.Replace(n, "*/", "*_/", -1))
+	}
+	fmt.Fprintf(t.c, "%s%s %s(%s) {\n", t.storage(), resultType(ty), name, strings.Join(params, ", "))
+
+	for i := len(ty.Params); i < len(f.locals); i++ {
+		fmt.Fprintf(t.c, "  %s l%d = 0;\n", cType(f.locals[i]), i)
+	}
+
+	var temps []string
+	for n := range f.temps {
+		temps = append(temps, n)
+	}
+	sort.Strings(temps)
+	for _, vt := range []wasm.ValueType{wasm.I32, wasm.I64, wasm.F32, wasm.F64} {
+		var decl []string
+		for _, n := range temps {
+			if f.temps[n] == vt {
+				decl = append(decl, n)
+			}
+		}
+		if len(decl) > 0 {
+			fmt.Fprintf(t.c, "  %s %s;\n", cType(vt), strings.Join(decl, ", "))
+		}
+	}
+
+	fmt.Fprint(t.c, "  FUNC_PROLOGUE;\n")
+	fmt.Fprint(t.c, f.sb.String())
+	fmt.Fprint(t.c, "}\n")
+	if f.lines != nil {
+		// Point the rest of the file back at itself.
+		fmt.Fprintf(t.c, "#line %d \"%s\"\n", t.c.lines+2, t.cName)
+	}
+	fmt.Fprint(t.c, "\n")
+	return nil
+}
+
+// lineDirective sets the Go source position to the one of the resume block pc.
+func (f *function) lineDirective(pc int) {
+	file, line := f.t.lines.pos(f.lines.name, pc)
+	if line <= 0 {
+		return
+	}
+	if file != f.lines.file {
+		f.lines.file = file
+		f.lines.fileDirty = true
+	}
+	f.lines.line = line
+}
+
+// writeLine emits a #line directive for the next C line. Every line needs
+// one, otherwise the compiler counts Go lines from the last directive.
+func (f *function) writeLine() {
+	l := f.lines
+	if l == nil || l.line <= 0 {
+		return
+	}
+	if l.fileDirty {
+		fmt.Fprintf(&f.sb, "#line %d \"%s\"\n", l.line, strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(l.file))
+		l.fileDirty = false
+	} else {
+		fmt.Fprintf(&f.sb, "#line %d\n", l.line)
+	}
+}
+
+// callLine marks a call at the top level of a resume block with the line of the Go call.
+func (f *function) callLine() {
+	l := f.lines
+	next := len(l.starts) - l.open
+	if len(f.frames) == 1+l.outer+l.open && next < len(l.starts) && l.starts[next] > 0 {
+		// The call returns to the start of the next resume block.
+		f.lineDirective(l.starts[next] - 1)
+	}
+}
+
+// resumeLine marks the start of a resume block with the line it continues at.
+func (f *function) resumeLine() {
+	l := f.lines
+	if open := len(f.frames) - 1 - l.outer; open < l.open {
+		l.open = open
+		if block := len(l.starts) - 1 - open; block < len(l.starts) && l.starts[block] >= 0 {
+			f.lineDirective(l.starts[block])
+		}
+	}
+}
+
+func (f *function) emit(format string, args ...interface{}) {
+	f.writeLine()
+	f.sb.WriteString("  ")
+	fmt.Fprintf(&f.sb, format, args...)
+	f.sb.WriteByte('\n')
+}
+
+func (f *function) label(format string, id int) {
+	f.writeLine()
+	fmt.Fprintf(&f.sb, " "+format+":;\n", id)
+}
+
+// slot returns the temporary holding the stack value at depth n.
+func (f *function) slot(n int, vt wasm.ValueType) string {
+	name := typeChar(vt) + strconv.Itoa(n)
+	f.temps[name] = vt
+	return name
+}
+
+func (f *function) push(vt wasm.ValueType) string {
+	f.stack = append(f.stack, vt)
+	return f.slot(len(f.stack)-1, vt)
+}
+
+func (f *function) pop() (string, error) {
+	if len(f.stack) <= f.frames[len(f.frames)-1].height {
+		return "", errors.New("stack underflow")
+	}
+	n := len(f.stack) - 1
+	vt := f.stack[n]
+	f.stack = f.stack[:n]
+	return f.slot(n, vt), nil
+}
+
+func (f *function) top() (string, wasm.ValueType) {
+	n := len(f.stack) - 1
+	return f.slot(n, f.stack[n]), f.stack[n]
+}
+
+// branch emits a jump to the label of the enclosing frame at depth.
+func (f *function) branch(depth uint32) (string, error) {
+	if int(depth) >= len(f.frames) {
+		return "", errors.New("invalid branch depth")
+	}
+
+	i := len(f.frames) - 1 - int(depth)
+	fr := &f.frames[i]
+	if i == 0 {
+		return f.ret(), nil
+	}
+	if fr.op == wasm.OpLoop {
+		fr.used = true
+		return fmt.Sprintf("goto L%d;", fr.label), nil
+	}
+
+	fr.used = true
+	jump := fmt.Sprintf("goto L%d;", fr.label)
+	if fr.result != 0 {
+		src, _ := f.top()
+		if dst := f.slot(fr.height, fr.result); dst != src {
+			jump = fmt.Sprintf("%s = %s; %s", dst, src, jump)
+		}
+	}
+	return jump, nil
+}
+
+func (f *function) ret() string {
+	if f.frames[0].result == 0 {
+		return "FUNC_EPILOGUE; return;"
+	}
+	v, _ := f.top()
+	return fmt.Sprintf("FUNC_EPILOGUE; return %s;", v)
+}
+
+func (f *function) instr(in *wasm.Instr) error {
+	if !f.live {
+		return f.deadInstr(in)
+	}
+
+	switch in.Op {
+	case wasm.OpUnreachable:
+		f.emit("UNREACHABLE;")
+		f.live = false
+	case wasm.OpNop:
+	case wasm.OpBlock, wasm.OpLoop:
+		fr := frame{op: in.Op, height: len(f.stack), label: f.labels, live: true}
+		if in.Imm != wasm.BlockEmpty {
+			fr.result = wasm.ValueType(in.Imm)
+		}
+		f.labels++
+		f.frames = append(f.frames, fr)
+		if in.Op == wasm.OpLoop {
+			f.label("L%d", fr.label)
+		}
+	case wasm.OpIf:
+		cond, err := f.pop()
+		if err != nil {
+			return err
+		}
+		fr := frame{op: in.Op, height: len(f.stack), label: f.labels, live: true}
+		if in.Imm != wasm.BlockEmpty {
+			fr.result = wasm.ValueType(in.Imm)
+		}
+		f.labels++
+		f.frames = append(f.frames, fr)
+		f.emit("if (!%s) goto E%d;", cond, fr.label)
+	case wasm.OpElse:
+		return f.elseInstr()
+	case wasm.OpEnd:
+		return f.end()
+	case wasm.OpBr:
+		jump, err := f.branch(uint32(in.Imm))
+		if err != nil {
+			return err
+		}
+		f.emit("%s", jump)
+		f.live = false
+	case wasm.OpBrIf:
+		cond, err := f.pop()
+		if err != nil {
+			return err
+		}
+		jump, err := f.branch(uint32(in.Imm))
+		if err != nil {
+			return err
+		}
+		f.emit("if (%s) {%s}", cond, jump)
+	case wasm.OpBrTable:
+		index, err := f.pop()
+		if err != nil {
+			return err
+		}
+		f.emit("switch (%s) {", index)
+		for i, target := range in.Targets {
+			jump, err := f.branch(target)
+			if err != nil {
+				return err
+			}
+			if i == len(in.Targets)-1 {
+				f.emit("  default: %s", jump)
+			} else {
+				f.emit("  case %d: %s", i, jump)
+			}
+		}
+		f.emit("}")
+		f.live = false
+	case wasm.OpReturn:
+		f.emit("%s", f.ret())
+		f.live = false
+	case wasm.OpCall:
+		return f.call(uint32(in.Imm))
+	case wasm.OpCallIndirect:
+		return f.callIndirect(uint32(in.Imm))
+	case wasm.OpDrop:
+		_, err := f.pop()
+		return err
+	case wasm.OpSelect:
+		cond, err := f.pop()
+		if err != nil {
+			return err
+		}
+		b, err := f.pop()
+		if err != nil {
+			return err
+		}
+		if len(f.stack) == 0 {
+			return errors.New("stack underflow")
+		}
+		vt := f.stack[len(f.stack)-1]
+		if _, err := f.pop(); err != nil {
+			return err
+		}
+		a := f.push(vt)
+		f.emit("%s = %s ? %s : %s;", a, cond, a, b)
+	case wasm.OpLocalGet:
+		if in.Imm >= uint64(len(f.locals)) {
+			return errors.New("invalid local")
+		}
+		f.emit("%s = l%d;", f.push(f.locals[in.Imm]), in.Imm)
+	case wasm.OpLocalSet:
+		v, err := f.pop()
+		if err != nil {
+			return err
+		}
+		f.emit("l%d = %s;", in.Imm, v)
+	case wasm.OpLocalTee:
+		if len(f.stack) == 0 {
+			return errors.New("stack underflow")
+		}
+		v, _ := f.top()
+		f.emit("l%d = %s;", in.Imm, v)
+	case wasm.OpGlobalGet:
+		if in.Imm >= uint64(len(f.t.m.Globals)) {
+			return errors.New("invalid global")
+		}
+		f.emit("%s = %s;", f.push(f.t.m.Globals[in.Imm].Type.Type), f.t.global(uint32(in.Imm)))
+	case wasm.OpGlobalSet:
+		v, err := f.pop()
+		if err != nil {
+			return err
+		}
+		f.emit("%s = %s;", f.t.global(uint32(in.Imm)), v)
+	case wasm.OpMemorySize:
+		f.emit("%s = %s.pages;", f.push(wasm.I32), f.t.memory)
+	case wasm.OpMemoryGrow:
+		v, err := f.pop()
+		if err != nil {
+			return err
+		}
+		f.emit("%s = wasm_rt_grow_memory((&%s), %s);", f.push(wasm.I32), f.t.memory, v)
+	case wasm.OpI32Const:
+		f.emit("%s = %du;", f.push(wasm.I32), uint32(in.Imm))
+	case wasm.OpI64Const:
+		f.emit("%s = %dull;", f.push(wasm.I64), in.Imm)
+	case wasm.OpF32Const:
+		f.emit("%s = %s;", f.push(wasm.F32), f32Const(in))
+	case wasm.OpF64Const:
+		f.emit("%s = %s;", f.push(wasm.F64), f64Const(in))
+	case wasm.OpMemoryCopy, wasm.OpMemoryFill:
+		n, err := f.pop()
+		if err != nil {
+			return err
+		}
+		src, err := f.pop()
+		if err != nil {
+			return err
+		}
+		dst, err := f.pop()
+		if err != nil {
+			return err
+		}
+		name := "memory_copy"
+		if in.Op == wasm.OpMemoryFill {
+			name = "memory_fill"
+		}
+		f.emit("%s((&%s), %s, %s, %s);", name, f.t.memory, dst, src, n)
+	case wasm.OpMemoryInit, wasm.OpDataDrop:
+		return errors.New("passive data segments are not supported")
+	default:
+		if in.Op >= wasm.OpI32Load && in.Op <= wasm.OpI64Store32 {
+			return f.memory(in)
+		}
+		return f.numeric(in.Op)
+	}
+	return nil
+}
+
+// deadInstr tracks the control structure of unreachable code without emitting it.
+func (f *function) deadInstr(in *wasm.Instr) error {
+	switch in.Op {
+	case wasm.OpBlock, wasm.OpLoop, wasm.OpIf:
+		f.frames = append(f.frames, frame{op: in.Op, height: len(f.stack)})
+	case wasm.OpElse:
+		return f.elseInstr()
+	case wasm.OpEnd:
+		return f.end()
+	}
+	return nil
+}
+
+func (f *function) elseInstr() error {
+	fr := &f.frames[len(f.frames)-1]
+	if fr.op != wasm.OpIf || fr.hasElse {
+		return errors.New("unexpected else")
+	}
+	fr.hasElse = true
+	if !fr.live {
+		return nil
+	}
+
+	if f.live {
+		fr.used = true
+		f.emit("goto L%d;", fr.label)
+	}
+	f.label("E%d", fr.label)
+	f.stack = f.stack[:fr.height]
+	f.live = true
+	return nil
+}
+
+func (f *function) end() error {
+	fr := f.frames[len(f.frames)-1]
+	f.stack = f.stack[:fr.height]
+
+	if len(f.frames) == 1 {
+		if f.live {
+			if fr.result != 0 {
+				f.push(fr.result)
+			}
+			f.emit("%s", f.ret())
+		}
+		f.frames = nil
+		return nil
+	}
+	f.frames = f.frames[:len(f.frames)-1]
+
+	if !fr.live {
+		return nil
+	}
+
+	live := f.live
+	if fr.op == wasm.OpIf && !fr.hasElse {
+		f.label("E%d", fr.label)
+		live = true
+	}
+	if fr.used && fr.op != wasm.OpLoop {
+		f.label("L%d", fr.label)
+		live = true
+	}
+
+	f.live = live
+	if fr.result != 0 {
+		f.push(fr.result)
+	}
+	return nil
+}
+
+func (f *function) call(index uint32) error {
+	if int(index) >= f.t.m.NumImportedFuncs()+len(f.t.m.Funcs) {
+		return errors.New("invalid function index")
+	}
+	return f.callWith(f.t.m.FuncType(index), f.t.callee(index))
+}
+
+func (f *function) callIndirect(typeIndex uint32) error {
+	if int(typeIndex) >= len(f.t.m.Types) || len(f.t.m.Tables) == 0 {
+		return errors.New("invalid call_indirect")
+	}
+
+	index, err := f.pop()
+	if err != nil {
+		return err
+	}
+
+	ty := f.t.m.Types[typeIndex]
+	table := f.t.table
+	f.emit("if (UNLIKELY(%s >= %s.size || %s.data[%s].func_type != %d || !%s.data[%s].func)) TRAP(CALL_INDIRECT);",
+		index, table, table, index, f.t.typeIDs[typeIndex], table, index)
+	callee := fmt.Sprintf("((%s (*)(%s))%s.data[%s].func)", resultType(ty), paramTypes(ty), table, index)
+	return f.callWith(ty, callee)
+}
+
+func (f *function) callWith(ty wasm.FuncType, callee string) error {
+	args := make([]string, len(ty.Params))
+	for i := len(ty.Params) - 1; i >= 0; i-- {
+		v, err := f.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = v
+	}
+
+	call := fmt.Sprintf("%s(%s);", callee, strings.Join(args, ", "))
+	if len(ty.Results) > 0 {
+		call = f.push(ty.Results[0]) + " = " + call
+	}
+	f.emit("%s", call)
+	return nil
+}
+
+var memoryOps = map[wasm.Opcode]struct {
+	name string
+	vt   wasm.ValueType
+}{
+	0x28: {"i32_load", wasm.I32},
+	0x29: {"i64_load", wasm.I64},
+	0x2A: {"f32_load", wasm.F32},
+	0x2B: {"f64_load", wasm.F64},
+	0x2C: {"i32_load8_s", wasm.I32},
+	0x2D: {"i32_load8_u", wasm.I32},
+	0x2E: {"i32_load16_s", wasm.I32},
+	0x2F: {"i32_load16_u", wasm.I32},
+	0x30: {"i64_load8_s", wasm.I64},
+	0x31: {"i64_load8_u", wasm.I64},
+	0x32: {"i64_load16_s", wasm.I64},
+	0x33: {"i64_load16_u", wasm.I64},
+	0x34: {"i64_load32_s", wasm.I64},
+	0x35: {"i64_load32_u", wasm.I64},
+	0x36: {"i32_store", wasm.I32},
+	0x37: {"i64_store", wasm.I64},
+	0x38: {"f32_store", wasm.F32},
+	0x39: {"f64_store", wasm.F64},
+	0x3A: {"i32_store8", wasm.I32},
+	0x3B: {"i32_store16", wasm.I32},
+	0x3C: {"i64_store8", wasm.I64},
+	0x3D: {"i64_store16", wasm.I64},
+	0x3E: {"i64_store32", wasm.I64},
+}
+
+func (f *function) memory(in *wasm.Instr) error {
+	op := memoryOps[in.Op]
+	if len(f.t.m.Memories) == 0 {
+		return errors.New("memory access without memory")
+	}
+
+	addr := func(v string) string {
+		if in.Offset == 0 {
+			return fmt.Sprintf("(u64)(%s)", v)
+		}
+		return fmt.Sprintf("(u64)(%s) + %du", v, in.Offset)
+	}
+
+	if in.Op >= 0x36 {
+		v, err := f.pop()
+		if err != nil {
+			return err
+		}
+		a, err := f.pop()
+		if err != nil {
+			return err
+		}
+		f.emit("%s((&%s), %s, %s);", op.name, f.t.memory, addr(a), v)
+		return nil
+	}
+
+	a, err := f.pop()
+	if err != nil {
+		return err
+	}
+	f.emit("%s = %s((&%s), %s);", f.push(op.vt), op.name, f.t.memory, addr(a))
+	return nil
+}
+
+type numericOp struct {
+	params []wasm.ValueType
+	result wasm.ValueType
+	// expr is a format string, %[1]s and %[2]s are the operands.
+	expr string
+}
+
+var (
+	i32    = []wasm.ValueType{wasm.I32}
+	i64    = []wasm.ValueType{wasm.I64}
+	f32    = []wasm.ValueType{wasm.F32}
+	f64    = []wasm.ValueType{wasm.F64}
+	i32i32 = []wasm.ValueType{wasm.I32, wasm.I32}
+	i64i64 = []wasm.ValueType{wasm.I64, wasm.I64}
+	f32f32 = []wasm.ValueType{wasm.F32, wasm.F32}
+	f64f64 = []wasm.ValueType{wasm.F64, wasm.F64}
+)
+
+var numericOps = map[wasm.Opcode]numericOp{
+	0x45: {i32, wasm.I32, "(u32)(%[1]s == 0)"},
+	0x46: {i32i32, wasm.I32, "(u32)(%[1]s == %[2]s)"},
+	0x47: {i32i32, wasm.I32, "(u32)(%[1]s != %[2]s)"},
+	0x48: {i32i32, wasm.I32, "(u32)((s32)%[1]s < (s32)%[2]s)"},
+	0x49: {i32i32, wasm.I32, "(u32)(%[1]s < %[2]s)"},
+	0x4A: {i32i32, wasm.I32, "(u32)((s32)%[1]s > (s32)%[2]s)"},
+	0x4B: {i32i32, wasm.I32, "(u32)(%[1]s > %[2]s)"},
+	0x4C: {i32i32, wasm.I32, "(u32)((s32)%[1]s <= (s32)%[2]s)"},
+	0x4D: {i32i32, wasm.I32, "(u32)(%[1]s <= %[2]s)"},
+	0x4E: {i32i32, wasm.I32, "(u32)((s32)%[1]s >= (s32)%[2]s)"},
+	0x4F: {i32i32, wasm.I32, "(u32)(%[1]s >= %[2]s)"},
+
+	0x50: {i64, wasm.I32, "(u32)(%[1]s == 0)"},
+	0x51: {i64i64, wasm.I32, "(u32)(%[1]s == %[2]s)"},
+	0x52: {i64i64, wasm.I32, "(u32)(%[1]s != %[2]s)"},
+	0x53: {i64i64, wasm.I32, "(u32)((s64)%[1]s < (s64)%[2]s)"},
+	0x54: {i64i64, wasm.I32, "(u32)(%[1]s < %[2]s)"},
+	0x55: {i64i64, wasm.I32, "(u32)((s64)%[1]s > (s64)%[2]s)"},
+	0x56: {i64i64, wasm.I32, "(u32)(%[1]s > %[2]s)"},
+	0x57: {i64i64, wasm.I32, "(u32)((s64)%[1]s <= (s64)%[2]s)"},
+	0x58: {i64i64, wasm.I32, "(u32)(%[1]s <= %[2]s)"},
+	0x59: {i64i64, wasm.I32, "(u32)((s64)%[1]s >= (s64)%[2]s)"},
+	0x5A: {i64i64, wasm.I32, "(u32)(%[1]s >= %[2]s)"},
+
+	0x5B: {f32f32, wasm.I32, "(u32)(%[1]s == %[2]s)"},
+	0x5C: {f32f32, wasm.I32, "(u32)(%[1]s != %[2]s)"},
+	0x5D: {f32f32, wasm.I32, "(u32)(%[1]s < %[2]s)"},
+	0x5E: {f32f32, wasm.I32, "(u32)(%[1]s > %[2]s)"},
+	0x5F: {f32f32, wasm.I32, "(u32)(%[1]s <= %[2]s)"},
+	0x60: {f32f32, wasm.I32, "(u32)(%[1]s >= %[2]s)"},
+
+	0x61: {f64f64, wasm.I32, "(u32)(%[1]s == %[2]s)"},
+	0x62: {f64f64, wasm.I32, "(u32)(%[1]s != %[2]s)"},
+	0x63: {f64f64, wasm.I32, "(u32)(%[1]s < %[2]s)"},
+	0x64: {f64f64, wasm.I32, "(u32)(%[1]s > %[2]s)"},
+	0x65: {f64f64, wasm.I32, "(u32)(%[1]s <= %[2]s)"},
+	0x66: {f64f64, wasm.I32, "(u32)(%[1]s >= %[2]s)"},
+
+	0x67: {i32, wasm.I32, "I32_CLZ(%[1]s)"},
+	0x68: {i32, wasm.I32, "I32_CTZ(%[1]s)"},
+	0x69: {i32, wasm.I32, "I32_POPCNT(%[1]s)"},
+	0x6A: {i32i32, wasm.I32, "%[1]s + %[2]s"},
+	0x6B: {i32i32, wasm.I32, "%[1]s - %[2]s"},
+	0x6C: {i32i32, wasm.I32, "%[1]s * %[2]s"},
+	0x6D: {i32i32, wasm.I32, "I32_DIV_S(%[1]s, %[2]s)"},
+	0x6E: {i32i32, wasm.I32, "DIV_U(%[1]s, %[2]s)"},
+	0x6F: {i32i32, wasm.I32, "I32_REM_S(%[1]s, %[2]s)"},
+	0x70: {i32i32, wasm.I32, "REM_U(%[1]s, %[2]s)"},
+	0x71: {i32i32, wasm.I32, "%[1]s & %[2]s"},
+	0x72: {i32i32, wasm.I32, "%[1]s | %[2]s"},
+	0x73: {i32i32, wasm.I32, "%[1]s ^ %[2]s"},
+	0x74: {i32i32, wasm.I32, "%[1]s << (%[2]s & 31)"},
+	0x75: {i32i32, wasm.I32, "(u32)((s32)%[1]s >> (%[2]s & 31))"},
+	0x76: {i32i32, wasm.I32, "%[1]s >> (%[2]s & 31)"},
+	0x77: {i32i32, wasm.I32, "I32_ROTL(%[1]s, %[2]s)"},
+	0x78: {i32i32, wasm.I32, "I32_ROTR(%[1]s, %[2]s)"},
+
+	0x79: {i64, wasm.I64, "I64_CLZ(%[1]s)"},
+	0x7A: {i64, wasm.I64, "I64_CTZ(%[1]s)"},
+	0x7B: {i64, wasm.I64, "I64_POPCNT(%[1]s)"},
+	0x7C: {i64i64, wasm.I64, "%[1]s + %[2]s"},
+	0x7D: {i64i64, wasm.I64, "%[1]s - %[2]s"},
+	0x7E: {i64i64, wasm.I64, "%[1]s * %[2]s"},
+	0x7F: {i64i64, wasm.I64, "I64_DIV_S(%[1]s, %[2]s)"},
+	0x80: {i64i64, wasm.I64, "DIV_U(%[1]s, %[2]s)"},
+	0x81: {i64i64, wasm.I64, "I64_REM_S(%[1]s, %[2]s)"},
+	0x82: {i64i64, wasm.I64, "REM_U(%[1]s, %[2]s)"},
+	0x83: {i64i64, wasm.I64, "%[1]s & %[2]s"},
+	0x84: {i64i64, wasm.I64, "%[1]s | %[2]s"},
+	0x85: {i64i64, wasm.I64, "%[1]s ^ %[2]s"},
+	0x86: {i64i64, wasm.I64, "%[1]s << (%[2]s & 63)"},
+	0x87: {i64i64, wasm.I64, "(u64)((s64)%[1]s >> (%[2]s & 63))"},
+	0x88: {i64i64, wasm.I64, "%[1]s >> (%[2]s & 63)"},
+	0x89: {i64i64, wasm.I64, "I64_ROTL(%[1]s, %[2]s)"},
+	0x8A: {i64i64, wasm.I64, "I64_ROTR(%[1]s, %[2]s)"},
+
+	0x8B: {f32, wasm.F32, "fabsf(%[1]s)"},
+	0x8C: {f32, wasm.F32, "-%[1]s"},
+	0x8D: {f32, wasm.F32, "ceilf(%[1]s)"},
+	0x8E: {f32, wasm.F32, "floorf(%[1]s)"},
+	0x8F: {f32, wasm.F32, "truncf(%[1]s)"},
+	0x90: {f32, wasm.F32, "nearbyintf(%[1]s)"},
+	0x91: {f32, wasm.F32, "sqrtf(%[1]s)"},
+	0x92: {f32f32, wasm.F32, "%[1]s + %[2]s"},
+	0x93: {f32f32, wasm.F32, "%[1]s - %[2]s"},
+	0x94: {f32f32, wasm.F32, "%[1]s * %[2]s"},
+	0x95: {f32f32, wasm.F32, "%[1]s / %[2]s"},
+	0x96: {f32f32, wasm.F32, "f32_min(%[1]s, %[2]s)"},
+	0x97: {f32f32, wasm.F32, "f32_max(%[1]s, %[2]s)"},
+	0x98: {f32f32, wasm.F32, "copysignf(%[1]s, %[2]s)"},
+
+	0x99: {f64, wasm.F64, "fabs(%[1]s)"},
+	0x9A: {f64, wasm.F64, "-%[1]s"},
+	0x9B: {f64, wasm.F64, "ceil(%[1]s)"},
+	0x9C: {f64, wasm.F64, "floor(%[1]s)"},
+	0x9D: {f64, wasm.F64, "trunc(%[1]s)"},
+	0x9E: {f64, wasm.F64, "nearbyint(%[1]s)"},
+	0x9F: {f64, wasm.F64, "sqrt(%[1]s)"},
+	0xA0: {f64f64, wasm.F64, "%[1]s + %[2]s"},
+	0xA1: {f64f64, wasm.F64, "%[1]s - %[2]s"},
+	0xA2: {f64f64, wasm.F64, "%[1]s * %[2]s"},
+	0xA3: {f64f64, wasm.F64, "%[1]s / %[2]s"},
+	0xA4: {f64f64, wasm.F64, "f64_min(%[1]s, %[2]s)"},
+	0xA5: {f64f64, wasm.F64, "f64_max(%[1]s, %[2]s)"},
+	0xA6: {f64f64, wasm.F64, "copysign(%[1]s, %[2]s)"},
+
+	0xA7: {i64, wasm.I32, "(u32)%[1]s"},
+	0xA8: {f32, wasm.I32, "i32_trunc_f32_s(%[1]s)"},
+	0xA9: {f32, wasm.I32, "i32_trunc_f32_u(%[1]s)"},
+	0xAA: {f64, wasm.I32, "i32_trunc_f64_s(%[1]s)"},
+	0xAB: {f64, wasm.I32, "i32_trunc_f64_u(%[1]s)"},
+	0xAC: {i32, wasm.I64, "(u64)(s64)(s32)%[1]s"},
+	0xAD: {i32, wasm.I64, "(u64)%[1]s"},
+	0xAE: {f32, wasm.I64, "i64_trunc_f32_s(%[1]s)"},
+	0xAF: {f32, wasm.I64, "i64_trunc_f32_u(%[1]s)"},
+	0xB0: {f64, wasm.I64, "i64_trunc_f64_s(%[1]s)"},
+	0xB1: {f64, wasm.I64, "i64_trunc_f64_u(%[1]s)"},
+	0xB2: {i32, wasm.F32, "(f32)(s32)%[1]s"},
+	0xB3: {i32, wasm.F32, "(f32)%[1]s"},
+	0xB4: {i64, wasm.F32, "(f32)(s64)%[1]s"},
+	0xB5: {i64, wasm.F32, "(f32)%[1]s"},
+	0xB6: {f64, wasm.F32, "(f32)%[1]s"},
+	0xB7: {i32, wasm.F64, "(f64)(s32)%[1]s"},
+	0xB8: {i32, wasm.F64, "(f64)%[1]s"},
+	0xB9: {i64, wasm.F64, "(f64)(s64)%[1]s"},
+	0xBA: {i64, wasm.F64, "(f64)%[1]s"},
+	0xBB: {f32, wasm.F64, "(f64)%[1]s"},
+	0xBC: {f32, wasm.I32, "i32_reinterpret_f32(%[1]s)"},
+	0xBD: {f64, wasm.I64, "i64_reinterpret_f64(%[1]s)"},
+	0xBE: {i32, wasm.F32, "f32_reinterpret_i32(%[1]s)"},
+	0xBF: {i64, wasm.F64, "f64_reinterpret_i64(%[1]s)"},
+
+	0xC0: {i32, wasm.I32, "(u32)(s32)(s8)%[1]s"},
+	0xC1: {i32, wasm.I32, "(u32)(s32)(s16)%[1]s"},
+	0xC2: {i64, wasm.I64, "(u64)(s64)(s8)%[1]s"},
+	0xC3: {i64, wasm.I64, "(u64)(s64)(s16)%[1]s"},
+	0xC4: {i64, wasm.I64, "(u64)(s64)(s32)%[1]s"},
+
+	0xFC00: {f32, wasm.I32, "i32_trunc_sat_f32_s(%[1]s)"},
+	0xFC01: {f32, wasm.I32, "i32_trunc_sat_f32_u(%[1]s)"},
+	0xFC02: {f64, wasm.I32, "i32_trunc_sat_f64_s(%[1]s)"},
+	0xFC03: {f64, wasm.I32, "i32_trunc_sat_f64_u(%[1]s)"},
+	0xFC04: {f32, wasm.I64, "i64_trunc_sat_f32_s(%[1]s)"},
+	0xFC05: {f32, wasm.I64, "i64_trunc_sat_f32_u(%[1]s)"},
+	0xFC06: {f64, wasm.I64, "i64_trunc_sat_f64_s(%[1]s)"},
+	0xFC07: {f64, wasm.I64, "i64_trunc_sat_f64_u(%[1]s)"},
+}
+
+func (f *function) numeric(op wasm.Opcode) error {
+	info, ok := numericOps[op]
+	if !ok {
+		return fmt.Errorf("unsupported opcode: 0x%X", uint16(op))
+	}
+
+	args := make([]interface{}, len(info.params))
+	for i := len(info.params) - 1; i >= 0; i-- {
+		v, err := f.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = v
+	}
+	f.emit("%s = %s;", f.push(info.result), fmt.Sprintf(info.expr, args...))
+	return nil
+}
+
+func f32Const(in *wasm.Instr) string {
+	v := float64(in.F32())
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("f32_reinterpret_i32(0x%08Xu)", uint32(in.Imm))
+	}
+	return floatLiteral(strconv.FormatFloat(v, 'g', -1, 32), math.Signbit(v)) + "f"
+}
+
+func f64Const(in *wasm.Instr) string {
+	v := in.F64()
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("f64_reinterpret_i64(0x%016Xull)", in.Imm)
+	}
+	return floatLiteral(strconv.FormatFloat(v, 'g', -1, 64), math.Signbit(v))
+}
+
+func floatLiteral(s string, negative bool) string {
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	if negative && !strings.HasPrefix(s, "-") {
+		s = "-" + s
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm2c
+
+import (
+	"bytes"
+	"debug/gosym"
+	"encoding/binary"
+	"regexp"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+)
+
+// The Go linker does not emit DWARF for js/wasm, but the runtime line table
+// (pclntab) is part of the data segments. A Go wasm PC is the function index
+// in the upper bits (PC_F) and a block index (PC_B) in the lower 16 bits.
+
+// pclntabMagics are the headers of the supported line table formats, with
+// the minimum instruction size and pointer size used by wasm.
+var pclntabMagics = [][]byte{
+	{0xF1, 0xFF, 0xFF, 0xFF, 0, 0, 1, 8}, // Go 1.20
+	{0xF0, 0xFF, 0xFF, 0xFF, 0, 0, 1, 8}, // Go 1.18
+	{0xFA, 0xFF, 0xFF, 0xFF, 0, 0, 1, 8}, // Go 1.16
+	{0xFB, 0xFF, 0xFF, 0xFF, 0, 0, 1, 8}, // Go 1.2
+}
+
+// nameSectionRegexp matches the characters the Go linker replaces with '_' in the name section.
+var nameSectionRegexp = regexp.MustCompile(`[^\w.]`)
+
+type lineTable struct {
+	tab *gosym.Table
+
+	// entries maps function names, as written in the name section, to entry
+	// PCs. The function indexes can not be used since dead code elimination
+	// renumbers them.
+	entries map[string]uint64
+
+	// names maps the name section names to the Go symbol names.
+	names map[string]string
+}
+
+// GoNames maps the function names in the name section to the Go symbol
+// names, like 'internal/abi.(*Type).Kind' for 'internal_abi.__Type_.Kind'.
+// It returns nil if the module has no Go line table.
+func GoNames(m *wasm.Module) map[string]string {
+	if lt := newLineTable(m); lt != nil {
+		return lt.names
+	}
+	return nil
+}
+
+// newLineTable decodes the Go line table from the data segments, it returns nil if there is none.
+func newLineTable(m *wasm.Module) *lineTable {
+	mem := memoryImage(m)
+	for _, magic := range pclntabMagics {
+		i := bytes.Index(mem, magic)
+		if i < 0 {
+			continue
+		}
+
+		data := mem[i:]
+		if magic[0] == 0xF1 || magic[0] == 0xF0 {
+			relocateFuncTab(data)
+		}
+
+		tab, err := gosym.NewTable(nil, gosym.NewLineTable(data, 0))
+		if err != nil || len(tab.Funcs) == 0 {
+			return nil
+		}
+		lt := &lineTable{tab: tab, entries: map[string]uint64{}, names: map[string]string{}}
+		for _, fn := range tab.Funcs {
+			name := nameSectionRegexp.ReplaceAllString(fn.Name, "_")
+			if _, ok := lt.names[name]; !ok {
+				lt.entries[name] = fn.Entry
+				lt.names[name] = fn.Name
+			}
+		}
+		return lt
+	}
+	return nil
+}
+
+// relocateFuncTab turns function entries stored as PC_F into PCs, the Go 1.18
+// and later formats store wasm entries without the block index bits.
+func relocateFuncTab(data []byte) {
+	// The header ends with the offset of the function table.
+	const header = 8 + 8*8
+	if len(data) < header {
+		return
+	}
+
+	le := binary.LittleEndian
+	nfunc := int(le.Uint64(data[8:]))
+	functab := int(le.Uint64(data[header-8:]))
+
+	end := functab + (nfunc+1)*8
+	if nfunc <= 0 || functab <= 0 || end > len(data) || le.Uint32(data[end-8:]) >= 1<<16 {
+		// Already PCs, or not something we understand.
+		return
+	}
+
+	for i := 0; i <= nfunc; i++ {
+		p := functab + i*8
+		le.PutUint32(data[p:], le.Uint32(data[p:])<<16)
+
+		// The function data starts with a copy of the entry.
+		if i < nfunc {
+			if fp := functab + int(le.Uint32(data[p+4:])); fp+4 <= len(data) {
+				le.PutUint32(data[fp:], le.Uint32(data[fp:])<<16)
+			}
+		}
+	}
+}
+
+// memoryImage returns the initial content of the linear memory.
+func memoryImage(m *wasm.Module) []byte {
+	var mem []byte
+	for _, data := range m.Data {
+		if data.Passive {
+			continue
+		}
+		instrs, err := wasm.Decode(data.Offset)
+		if err != nil || len(instrs) == 0 || instrs[0].Op != wasm.OpI32Const {
+			continue
+		}
+
+		offset := int(uint32(instrs[0].I32()))
+		if end := offset + len(data.Bytes); end > len(mem) {
+			mem = append(mem, make([]byte, end-len(mem))...)
+		}
+		copy(mem[offset:], data.Bytes)
+	}
+	return mem
+}
+
+// pos returns the source position of block in the named function.
+func (lt *lineTable) pos(name string, block int) (string, int) {
+	entry, ok := lt.entries[name]
+	if !ok {
+		return "", 0
+	}
+	file, line, fn := lt.tab.PCToLine(entry | uint64(block))
+	if fn == nil {
+		return "", 0
+	}
+	return file, line
+}
+
+// resumePoints returns the PC_B at the start of each resume block of a Go
+// function. Functions that can be resumed have one block per resume point
+// and a br_table that selects where to continue, after a short prologue that
+// may copy SP to a local. Older compilers put the blocks in a loop. It returns
+// the number of instructions up to and including the br_table, and the number
+// of blocks and loops that encloses the resume blocks.
+func resumePoints(instrs []wasm.Instr) ([]int, int, int) {
+	n, outer, blocks := 0, 0, 0
+	for ; n+1 < len(instrs) && instrs[n+1].Op != wasm.OpBrTable; n++ {
+		switch op := instrs[n].Op; {
+		case op == wasm.OpBlock:
+			blocks++
+		case op == wasm.OpLoop:
+			outer += blocks + 1
+			blocks = 0
+		case op < wasm.OpDrop || blocks > 0 || n >= 8:
+			return nil, 0, 0
+		}
+	}
+	if n+1 >= len(instrs) || blocks == 0 {
+		return nil, 0, 0
+	}
+	if op := instrs[n].Op; op != wasm.OpGlobalGet && op != wasm.OpLocalGet {
+		return nil, 0, 0
+	}
+
+	// The default target is the outermost resume block, any blocks outside it belong to the prologue.
+	targets := instrs[n+1].Targets
+	if resume := int(targets[len(targets)-1]) + 1; resume < blocks {
+		outer += blocks - resume
+		blocks = resume
+	}
+
+	// The br_table maps each PC_B to a block, the first PC_B of a block is its resume point.
+	starts := make([]int, blocks)
+	for i := range starts {
+		starts[i] = -1
+	}
+	starts[0] = 0
+	for pc, target := range targets[:len(targets)-1] {
+		if int(target) < blocks && starts[target] < 0 {
+			starts[target] = pc
+		}
+	}
+	return starts, n + 2, outer
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm2c
+
+const headerPrelude = `#include <stdint.h>
+
+#include "wasm-rt.h"
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#ifndef WASM_RT_CORE_TYPES_DEFINED
+#define WASM_RT_CORE_TYPES_DEFINED
+typedef uint8_t u8;
+typedef int8_t s8;
+typedef uint16_t u16;
+typedef int16_t s16;
+typedef uint32_t u32;
+typedef int32_t s32;
+typedef uint64_t u64;
+typedef int64_t s64;
+typedef float f32;
+typedef double f64;
+#endif
+
+#ifndef WASM_RT_MODULE_PREFIX
+#define WASM_RT_MODULE_PREFIX
+#endif
+
+#define WASM_RT_PASTE_(x, y) x ## y
+#define WASM_RT_PASTE(x, y) WASM_RT_PASTE_(x, y)
+#define WASM_RT_ADD_PREFIX(x) WASM_RT_PASTE(WASM_RT_MODULE_PREFIX, x)
+
+extern void WASM_RT_ADD_PREFIX(init)(void);
+`
+
+// SharedPrelude starts the header shared by the units of a split translation,
+// it defines W2C_HIDDEN that hides the shared symbols outside the library.
+const SharedPrelude = `#if (defined(__GNUC__) || defined(__clang__)) && !defined(_WIN32)
+  #define W2C_HIDDEN __attribute__((visibility("hidden")))
+#else
+  #define W2C_HIDDEN
+#endif
+
+`
+
+const sourcePrelude = `#include <math.h>
+#include <string.h>
+
+#if defined(_MSC_VER) && !defined(__cplusplus)
+  #define inline __inline
+#endif
+
+#ifndef UNLIKELY
+  #if defined(__GNUC__) || defined(__clang__)
+    #define UNLIKELY(x) __builtin_expect(!!(x), 0)
+    #define LIKELY(x) __builtin_expect(!!(x), 1)
+  #else
+    #define UNLIKELY(x) (x)
+    #define LIKELY(x) (x)
+  #endif
+#endif
+
+#define TRAP(x) (wasm_rt_trap(WASM_RT_TRAP_##x), 0)
+
+#define FUNC_PROLOGUE                                            \
+  if (++wasm_rt_call_stack_depth > WASM_RT_MAX_CALL_STACK_DEPTH) \
+    TRAP(EXHAUSTION)
+
+#define FUNC_EPILOGUE --wasm_rt_call_stack_depth
+
+#define UNREACHABLE TRAP(UNREACHABLE)
+
+#define MEMCHECK(mem, a, t) \
+  if (UNLIKELY((a) + sizeof(t) > (mem)->size)) TRAP(OOB)
+
+#define DEFINE_LOAD(name, t1, t2, t3)                                \
+  static inline t3 name(wasm_rt_memory_t* mem, u64 addr) {           \
+    t1 result;                                                       \
+    MEMCHECK(mem, addr, t1);                                         \
+    memcpy(&result, &mem->data[addr], sizeof(t1));                   \
+    return (t3)(t2)result;                                           \
+  }
+
+#define DEFINE_STORE(name, t1, t2)                                   \
+  static inline void name(wasm_rt_memory_t* mem, u64 addr, t2 value) { \
+    t1 wrapped = (t1)value;                                          \
+    MEMCHECK(mem, addr, t1);                                         \
+    memcpy(&mem->data[addr], &wrapped, sizeof(t1));                  \
+  }
+
+DEFINE_LOAD(i32_load, u32, u32, u32)
+DEFINE_LOAD(i64_load, u64, u64, u64)
+DEFINE_LOAD(f32_load, f32, f32, f32)
+DEFINE_LOAD(f64_load, f64, f64, f64)
+DEFINE_LOAD(i32_load8_s, s8, s32, u32)
+DEFINE_LOAD(i64_load8_s, s8, s64, u64)
+DEFINE_LOAD(i32_load8_u, u8, u32, u32)
+DEFINE_LOAD(i64_load8_u, u8, u64, u64)
+DEFINE_LOAD(i32_load16_s, s16, s32, u32)
+DEFINE_LOAD(i64_load16_s, s16, s64, u64)
+DEFINE_LOAD(i32_load16_u, u16, u32, u32)
+DEFINE_LOAD(i64_load16_u, u16, u64, u64)
+DEFINE_LOAD(i64_load32_s, s32, s64, u64)
+DEFINE_LOAD(i64_load32_u, u32, u64, u64)
+DEFINE_STORE(i32_store, u32, u32)
+DEFINE_STORE(i64_store, u64, u64)
+DEFINE_STORE(f32_store, f32, f32)
+DEFINE_STORE(f64_store, f64, f64)
+DEFINE_STORE(i32_store8, u8, u32)
+DEFINE_STORE(i32_store16, u16, u32)
+DEFINE_STORE(i64_store8, u8, u64)
+DEFINE_STORE(i64_store16, u16, u64)
+DEFINE_STORE(i64_store32, u32, u64)
+
+static inline void memory_copy(wasm_rt_memory_t* mem, u32 dest, u32 src, u32 n) {
+  if (UNLIKELY((u64)dest + n > mem->size || (u64)src + n > mem->size)) TRAP(OOB);
+  memmove(&mem->data[dest], &mem->data[src], n);
+}
+
+static inline void memory_fill(wasm_rt_memory_t* mem, u32 dest, u32 value, u32 n) {
+  if (UNLIKELY((u64)dest + n > mem->size)) TRAP(OOB);
+  memset(&mem->data[dest], (int)(u8)value, n);
+}
+
+#if defined(__GNUC__) || defined(__clang__)
+  #define I32_CLZ(x) ((x) ? (u32)__builtin_clz(x) : 32)
+  #define I64_CLZ(x) ((x) ? (u64)__builtin_clzll(x) : 64)
+  #define I32_CTZ(x) ((x) ? (u32)__builtin_ctz(x) : 32)
+  #define I64_CTZ(x) ((x) ? (u64)__builtin_ctzll(x) : 64)
+  #define I32_POPCNT(x) ((u32)__builtin_popcount(x))
+  #define I64_POPCNT(x) ((u64)__builtin_popcountll(x))
+#else
+  static inline u32 I32_CLZ(u32 x) { u32 n = 0; if (!x) return 32; while (!(x & 0x80000000u)) { x <<= 1; n++; } return n; }
+  static inline u64 I64_CLZ(u64 x) { u64 n = 0; if (!x) return 64; while (!(x & 0x8000000000000000ull)) { x <<= 1; n++; } return n; }
+  static inline u32 I32_CTZ(u32 x) { u32 n = 0; if (!x) return 32; while (!(x & 1)) { x >>= 1; n++; } return n; }
+  static inline u64 I64_CTZ(u64 x) { u64 n = 0; if (!x) return 64; while (!(x & 1)) { x >>= 1; n++; } return n; }
+  static inline u32 I32_POPCNT(u32 x) { u32 n = 0; while (x) { x &= x - 1; n++; } return n; }
+  static inline u64 I64_POPCNT(u64 x) { u64 n = 0; while (x) { x &= x - 1; n++; } return n; }
+#endif
+
+#define DIV_S(ut, min, x, y)                                   \
+   ((UNLIKELY((y) == 0)) ?                TRAP(DIV_BY_ZERO)    \
+  : (UNLIKELY((x) == min && (y) == -1)) ? TRAP(INT_OVERFLOW)   \
+  : (ut)((x) / (y)))
+
+#define REM_S(ut, min, x, y)                                   \
+   ((UNLIKELY((y) == 0)) ?                TRAP(DIV_BY_ZERO)    \
+  : (UNLIKELY((x) == min && (y) == -1)) ? 0                    \
+  : (ut)((x) % (y)))
+
+#define I32_DIV_S(x, y) DIV_S(u32, INT32_MIN, (s32)(x), (s32)(y))
+#define I64_DIV_S(x, y) DIV_S(u64, INT64_MIN, (s64)(x), (s64)(y))
+#define I32_REM_S(x, y) REM_S(u32, INT32_MIN, (s32)(x), (s32)(y))
+#define I64_REM_S(x, y) REM_S(u64, INT64_MIN, (s64)(x), (s64)(y))
+
+#define DIVREM_U(op, x, y) \
+  ((UNLIKELY((y) == 0)) ? TRAP(DIV_BY_ZERO) : ((x) op (y)))
+
+#define DIV_U(x, y) DIVREM_U(/, x, y)
+#define REM_U(x, y) DIVREM_U(%, x, y)
+
+#define ROTL(x, y, mask) \
+  (((x) << ((y) & (mask))) | ((x) >> (((mask) - (y) + 1) & (mask))))
+#define ROTR(x, y, mask) \
+  (((x) >> ((y) & (mask))) | ((x) << (((mask) - (y) + 1) & (mask))))
+
+#define I32_ROTL(x, y) ROTL(x, y, 31)
+#define I64_ROTL(x, y) ROTL(x, y, 63)
+#define I32_ROTR(x, y) ROTR(x, y, 31)
+#define I64_ROTR(x, y) ROTR(x, y, 63)
+
+#define DEFINE_REINTERPRET(name, t1, t2) \
+  static inline t2 name(t1 x) {          \
+    t2 result;                           \
+    memcpy(&result, &x, sizeof(result)); \
+    return result;                       \
+  }
+
+DEFINE_REINTERPRET(f32_reinterpret_i32, u32, f32)
+DEFINE_REINTERPRET(i32_reinterpret_f32, f32, u32)
+DEFINE_REINTERPRET(f64_reinterpret_i64, u64, f64)
+DEFINE_REINTERPRET(i64_reinterpret_f64, f64, u64)
+
+#define DEFINE_MINMAX(name, t, op, sign)        \
+  static inline t name(t x, t y) {              \
+    if (UNLIKELY(x != x || y != y)) return x + y; \
+    if (UNLIKELY(x == y)) return sign ? x : y;  \
+    return x op y ? x : y;                      \
+  }
+
+DEFINE_MINMAX(f32_min, f32, <, signbit(x))
+DEFINE_MINMAX(f64_min, f64, <, signbit(x))
+DEFINE_MINMAX(f32_max, f32, >, !signbit(x))
+DEFINE_MINMAX(f64_max, f64, >, !signbit(x))
+
+#define DEFINE_TRUNC(name, ft, ut, st, lo, loop, hi)                 \
+  static inline ut name(ft x) {                                      \
+    if (UNLIKELY(x != x)) TRAP(INVALID_CONVERSION);                  \
+    if (UNLIKELY(!(x loop (ft)(lo) && x < (ft)(hi)))) TRAP(INT_OVERFLOW); \
+    return (ut)(st)x;                                                \
+  }
+
+DEFINE_TRUNC(i32_trunc_f32_s, f32, u32, s32, -2147483648.0, >=, 2147483648.0)
+DEFINE_TRUNC(i32_trunc_f32_u, f32, u32, u32, -1.0, >, 4294967296.0)
+DEFINE_TRUNC(i32_trunc_f64_s, f64, u32, s32, -2147483649.0, >, 2147483648.0)
+DEFINE_TRUNC(i32_trunc_f64_u, f64, u32, u32, -1.0, >, 4294967296.0)
+DEFINE_TRUNC(i64_trunc_f32_s, f32, u64, s64, -9223372036854775808.0, >=, 9223372036854775808.0)
+DEFINE_TRUNC(i64_trunc_f32_u, f32, u64, u64, -1.0, >, 18446744073709551616.0)
+DEFINE_TRUNC(i64_trunc_f64_s, f64, u64, s64, -9223372036854775808.0, >=, 9223372036854775808.0)
+DEFINE_TRUNC(i64_trunc_f64_u, f64, u64, u64, -1.0, >, 18446744073709551616.0)
+
+#define DEFINE_TRUNC_SAT(name, ft, ut, st, lo, loop, hi, min, max) \
+  static inline ut name(ft x) {                                    \
+    if (UNLIKELY(x != x)) return 0;                                \
+    if (UNLIKELY(!(x loop (ft)(lo)))) return (ut)(min);            \
+    if (UNLIKELY(!(x < (ft)(hi)))) return (ut)(max);               \
+    return (ut)(st)x;                                              \
+  }
+
+DEFINE_TRUNC_SAT(i32_trunc_sat_f32_s, f32, u32, s32, -2147483648.0, >=, 2147483648.0, INT32_MIN, INT32_MAX)
+DEFINE_TRUNC_SAT(i32_trunc_sat_f32_u, f32, u32, u32, -1.0, >, 4294967296.0, 0, UINT32_MAX)
+DEFINE_TRUNC_SAT(i32_trunc_sat_f64_s, f64, u32, s32, -2147483649.0, >, 2147483648.0, INT32_MIN, INT32_MAX)
+DEFINE_TRUNC_SAT(i32_trunc_sat_f64_u, f64, u32, u32, -1.0, >, 4294967296.0, 0, UINT32_MAX)
+DEFINE_TRUNC_SAT(i64_trunc_sat_f32_s, f32, u64, s64, -9223372036854775808.0, >=, 9223372036854775808.0, INT64_MIN, INT64_MAX)
+DEFINE_TRUNC_SAT(i64_trunc_sat_f32_u, f32, u64, u64, -1.0, >, 18446744073709551616.0, 0, UINT64_MAX)
+DEFINE_TRUNC_SAT(i64_trunc_sat_f64_s, f64, u64, s64, -9223372036854775808.0, >=, 9223372036854775808.0, INT64_MIN, INT64_MAX)
+DEFINE_TRUNC_SAT(i64_trunc_sat_f64_u, f64, u64, u64, -1.0, >, 18446744073709551616.0, 0, UINT64_MAX)
+`
+
+// dataIncbin embeds the data segment file with the assembler, the arguments
+// are the file name and its size.
+const dataIncbin = `#if defined(__APPLE__)
+#define DATA_SECTION ".const_data\n"
+#define DATA_END ".text\n"
+#elif defined(_WIN32)
+#define DATA_SECTION ".section .rdata,\"dr\"\n"
+#define DATA_END ".text\n"
+#else
+#define DATA_SECTION ".pushsection .rodata\n"
+#define DATA_END ".type data_segment_data, STT_OBJECT\n.size data_segment_data, %[2]d\n.popsection\n"
+#endif
+
+__asm__(DATA_SECTION ".p2align 4\ndata_segment_data:\n.incbin \"%[1]s\"\n" DATA_END);
+extern const u8 data_segment_data[] __asm__("data_segment_data");
+
+`
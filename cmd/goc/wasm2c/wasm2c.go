@@ -0,0 +1,668 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+// Package wasm2c translates a WebAssembly module to C, using the same runtime
+// interface and symbol names as the wabt wasm2c tool.
+package wasm2c
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/gopherc/goc/cmd/goc/wasm"
+)
+
+// Version identifies the translator output, it is part of the build cache key.
+const Version = "4"
+
+// DataMode selects how the data segments are included in the C source.
+type DataMode int
+
+const (
+	// DataArray writes the data segments as C arrays.
+	DataArray DataMode = iota
+
+	// DataIncbin embeds a binary file with the data segments using the
+	// assembler .incbin directive. The file is named as the header, but
+	// with a .data extension, and is found through the include path.
+	DataIncbin
+)
+
+// Options controls the translation.
+type Options struct {
+	// Debug names the C functions after the Go functions and adds #line
+	// directives that points debuggers at the Go sources.
+	Debug bool
+
+	Data DataMode
+
+	// Units is the number of C files the functions are spread over, so they
+	// can be compiled in parallel. The extra files are named as the C file
+	// with _1, _2 and so on added, and share the module state through a
+	// header with a _shared.h suffix. Only TranslateFile writes more than one.
+	Units int
+
+	// Prefix is added to the symbols shared between units, so they do not
+	// clash with other code linked into the same program. The symbols also
+	// have hidden visibility where the compiler supports it.
+	Prefix string
+}
+
+// UnitFiles returns the files written for a C file when split into units,
+// the shared header and the C files other than cFile itself.
+func UnitFiles(cFile string, units int) []string {
+	if units < 2 {
+		return nil
+	}
+	base := strings.TrimSuffix(cFile, filepath.Ext(cFile))
+	files := []string{base + "_shared.h"}
+	for i := 1; i < units; i++ {
+		files = append(files, fmt.Sprintf("%s_%d.c", base, i))
+	}
+	return files
+}
+
+// TranslateFile translates the wasm file to a C source file and a header next
+// to it, and the data segment file when selected by the options.
+func TranslateFile(wasmFile, cFile string, opt Options) error {
+	m, err := wasm.ReadFile(wasmFile)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(cFile, filepath.Ext(cFile))
+	hFile := base + ".h"
+	if opt.Data == DataIncbin {
+		if err := ioutil.WriteFile(base+".data", DataBlob(m), 0644); err != nil {
+			return err
+		}
+	}
+
+	files := append([]string{cFile, hFile}, UnitFiles(cFile, opt.Units)...)
+	var writers []*bufio.Writer
+	for _, name := range files {
+		fp, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		writers = append(writers, bufio.NewWriter(fp))
+	}
+
+	t := newTranslator(m, writers[0], writers[1], filepath.Base(hFile), opt)
+	if opt.Units > 1 {
+		t.prefix = opt.Prefix
+		t.shared, t.sharedName = writers[2], filepath.Base(files[2])
+		for i, w := range writers[3:] {
+			t.units = append(t.units, &lineWriter{w: w})
+			t.unitNames = append(t.unitNames, filepath.Base(files[3+i]))
+		}
+	}
+	if err := t.translate(filepath.Base(hFile)); err != nil {
+		return err
+	}
+
+	for _, w := range writers {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Translate writes the module as C source to c and the matching declarations to h.
+// The C source is assumed to be named as the header, but with a .c extension.
+func Translate(m *wasm.Module, c, h io.Writer, headerName string, opt Options) error {
+	if opt.Units > 1 {
+		return errors.New("wasm2c: Translate writes a single unit, use TranslateFile")
+	}
+	return newTranslator(m, c, h, headerName, opt).translate(headerName)
+}
+
+func newTranslator(m *wasm.Module, c, h io.Writer, headerName string, opt Options) *translator {
+	t := &translator{m: m, c: &lineWriter{w: c}, h: h}
+	t.units = []*lineWriter{t.c}
+	t.unitNames = []string{strings.TrimSuffix(headerName, filepath.Ext(headerName)) + ".c"}
+	if opt.Data == DataIncbin {
+		t.dataName = strings.TrimSuffix(headerName, filepath.Ext(headerName)) + ".data"
+	}
+	if opt.Debug {
+		t.debug = true
+		t.lines = newLineTable(m)
+		t.cName = t.unitNames[0]
+	}
+	return t
+}
+
+type translator struct {
+	m *wasm.Module
+	c *lineWriter
+	h io.Writer
+
+	// typeIDs maps each type index to the first identical signature, used for call_indirect checks.
+	typeIDs []uint32
+
+	debug bool
+	cName string
+	lines *lineTable
+
+	// dataName is the data segment file, if not written as C arrays.
+	dataName string
+
+	// units are the C files the functions are written to, the first is c.
+	// With more than one unit the module state is declared in shared and
+	// the shared symbols are named with prefix.
+	units      []*lineWriter
+	unitNames  []string
+	shared     io.Writer
+	sharedName string
+	prefix     string
+
+	// memory and table are the C names of the memory and table.
+	memory, table string
+}
+
+// lineWriter counts the lines written, for #line directives that refers to the output itself.
+type lineWriter struct {
+	w     io.Writer
+	lines int
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lines += bytes.Count(p, []byte("\n"))
+	return w.w.Write(p)
+}
+
+func (t *translator) translate(headerName string) error {
+	m := t.m
+	t.memory, t.table = t.prefix+"M0", t.prefix+"T0"
+	if len(m.Memories) > 1 || len(m.Tables) > 1 {
+		return errors.New("wasm2c: multiple memories or tables are not supported")
+	}
+
+	for i, ty := range m.Types {
+		if len(ty.Results) > 1 {
+			return errors.New("wasm2c: multiple results are not supported")
+		}
+		id := uint32(i)
+		for j := 0; j < i; j++ {
+			if m.Types[j].Equal(ty) {
+				id = uint32(j)
+				break
+			}
+		}
+		t.typeIDs = append(t.typeIDs, id)
+	}
+
+	guard := "WASM2C_" + strings.ToUpper(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, headerName)) + "_"
+
+	fmt.Fprint(t.h, "// Generated by the GopherC translator.\n\n")
+	fmt.Fprintf(t.h, "#ifndef %s\n#define %s\n\n", guard, guard)
+	fmt.Fprint(t.h, headerPrelude)
+
+	include := headerName
+	if t.shared != nil {
+		include = t.sharedName
+		sharedGuard := guard + "SHARED_"
+		fmt.Fprint(t.shared, "// Generated by the GopherC translator.\n\n")
+		fmt.Fprintf(t.shared, "#ifndef %s\n#define %s\n\n", sharedGuard, sharedGuard)
+		fmt.Fprintf(t.shared, "#include \"%s\"\n\n", headerName)
+		fmt.Fprint(t.shared, SharedPrelude)
+		defer fmt.Fprintf(t.shared, "\n#endif /* %s */\n", sharedGuard)
+	}
+	for _, w := range t.units {
+		fmt.Fprint(w, "// Generated by the GopherC translator.\n\n")
+		fmt.Fprintf(w, "#include \"%s\"\n\n", include)
+		fmt.Fprint(w, sourcePrelude)
+		fmt.Fprint(w, "\n")
+	}
+
+	if err := t.writeImports(); err != nil {
+		return err
+	}
+
+	t.writeDeclarations()
+	if err := t.writeGlobals(); err != nil {
+		return err
+	}
+
+	// Spread the functions over the units in order, with about the same amount of code in each.
+	var total, size int
+	for _, code := range m.Codes {
+		total += len(code.Body)
+	}
+
+	numImports := m.NumImportedFuncs()
+	for i, code := range m.Codes {
+		unit := size * len(t.units) / (total + 1)
+		t.c = t.units[unit]
+		if t.debug {
+			t.cName = t.unitNames[unit]
+		}
+		size += len(code.Body)
+
+		index := uint32(numImports + i)
+		if err := t.writeFunction(index, &code); err != nil {
+			name := m.FuncName(index)
+			if name == "" {
+				name = t.funcName(index)
+			}
+			return fmt.Errorf("wasm2c: %s: %v", name, err)
+		}
+	}
+	t.c = t.units[0]
+	if t.debug {
+		t.cName = t.unitNames[0]
+	}
+
+	if err := t.writeMemory(); err != nil {
+		return err
+	}
+	if err := t.writeTable(); err != nil {
+		return err
+	}
+	if err := t.writeExports(); err != nil {
+		return err
+	}
+
+	fmt.Fprint(t.c, "void WASM_RT_ADD_PREFIX(init)(void) {\n")
+	fmt.Fprint(t.c, "  init_globals();\n  init_memory();\n  init_table();\n  init_exports();\n")
+	if m.Start != nil {
+		fmt.Fprintf(t.c, "  %s();\n", t.callee(*m.Start))
+	}
+	fmt.Fprint(t.c, "}\n")
+
+	fmt.Fprint(t.h, "\n#ifdef __cplusplus\n}\n#endif\n\n")
+	fmt.Fprintf(t.h, "#endif /* %s */\n", guard)
+	return nil
+}
+
+func (t *translator) writeImports() error {
+	for _, imp := range t.m.Imports {
+		if imp.Kind != wasm.KindFunc {
+			return fmt.Errorf("wasm2c: unsupported import: %s.%s", imp.Module, imp.Name)
+		}
+
+		ty := t.m.Types[imp.Type]
+		fmt.Fprintf(t.h, "\n/* import: '%s' '%s' */\n", imp.Module, imp.Name)
+		fmt.Fprintf(t.h, "extern %s (*%s)(%s);\n", resultType(ty), MangleImport(imp.Module, imp.Name, ty), paramTypes(ty))
+	}
+	return nil
+}
+
+// writeDeclarations declares the module state and the functions. With more
+// than one unit they are declared in the shared header and the state is
+// defined in the first unit.
+func (t *translator) writeDeclarations() {
+	m := t.m
+	var state []string
+	if len(m.Memories) > 0 {
+		state = append(state, "wasm_rt_memory_t "+t.memory)
+	}
+	if len(m.Tables) > 0 {
+		state = append(state, "wasm_rt_table_t "+t.table)
+	}
+	for i, g := range m.Globals {
+		state = append(state, cType(g.Type.Type)+" "+t.global(uint32(i)))
+	}
+
+	var decl io.Writer = t.c
+	if t.shared != nil {
+		decl = t.shared
+		for _, s := range state {
+			fmt.Fprintf(t.shared, "extern W2C_HIDDEN %s;\n", s)
+		}
+		fmt.Fprint(t.shared, "\n")
+	}
+	for _, s := range state {
+		fmt.Fprintf(t.c, "%s%s;\n", t.storage(), s)
+	}
+	fmt.Fprint(t.c, "\n")
+
+	numImports := m.NumImportedFuncs()
+	for i, typeIndex := range m.Funcs {
+		ty := m.Types[typeIndex]
+		fmt.Fprintf(decl, "%s%s %s(%s);\n", t.storage(), resultType(ty), t.funcName(uint32(numImports+i)), paramTypes(ty))
+	}
+	fmt.Fprint(decl, "\n")
+}
+
+// storage returns the storage class of the module state and the functions,
+// they are static unless shared between units.
+func (t *translator) storage() string {
+	if t.shared != nil {
+		return "W2C_HIDDEN "
+	}
+	return "static "
+}
+
+func (t *translator) writeGlobals() error {
+	fmt.Fprint(t.c, "static void init_globals(void) {\n")
+	for i, g := range t.m.Globals {
+		value, err := t.constExpr(g.Init)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(t.c, "  %s = %s;\n", t.global(uint32(i)), value)
+	}
+	fmt.Fprint(t.c, "}\n\n")
+	return nil
+}
+
+func (t *translator) writeMemory() error {
+	m := t.m
+	for i, data := range m.Data {
+		if data.Passive {
+			return errors.New("wasm2c: passive data segments are not supported")
+		}
+		if len(data.Bytes) == 0 || t.dataName != "" {
+			continue
+		}
+
+		fmt.Fprintf(t.c, "static const u8 data_segment_data_%d[] = {\n", i)
+		for j, b := range data.Bytes {
+			if j%16 == 0 {
+				fmt.Fprint(t.c, "  ")
+			}
+			fmt.Fprintf(t.c, "0x%02x, ", b)
+			if j%16 == 15 || j == len(data.Bytes)-1 {
+				fmt.Fprint(t.c, "\n")
+			}
+		}
+		fmt.Fprint(t.c, "};\n\n")
+	}
+
+	blob := 0
+	if t.dataName != "" {
+		for _, data := range m.Data {
+			blob += len(data.Bytes)
+		}
+		if blob > 0 {
+			fmt.Fprintf(t.c, dataIncbin, t.dataName, blob)
+		}
+	}
+
+	fmt.Fprint(t.c, "static void init_memory(void) {\n")
+	if len(m.Memories) > 0 {
+		lim := m.Memories[0].Limits
+		max := uint32(65536)
+		if lim.HasMax {
+			max = lim.Max
+		}
+		fmt.Fprintf(t.c, "  wasm_rt_allocate_memory((&%s), %d, %d);\n", t.memory, lim.Min, max)
+
+		pos := 0
+		for i, data := range m.Data {
+			if len(data.Bytes) == 0 {
+				continue
+			}
+			offset, err := t.constExpr(data.Offset)
+			if err != nil {
+				return err
+			}
+			if t.dataName != "" {
+				fmt.Fprintf(t.c, "  memcpy(&(%s.data[%s]), data_segment_data + %d, %d);\n", t.memory, offset, pos, len(data.Bytes))
+				pos += len(data.Bytes)
+			} else {
+				fmt.Fprintf(t.c, "  memcpy(&(%s.data[%s]), data_segment_data_%d, %d);\n", t.memory, offset, i, len(data.Bytes))
+			}
+		}
+	}
+	fmt.Fprint(t.c, "}\n\n")
+	return nil
+}
+
+func (t *translator) writeTable() error {
+	m := t.m
+	fmt.Fprint(t.c, "static void init_table(void) {\n")
+	if len(m.Tables) > 0 {
+		lim := m.Tables[0].Limits
+		max := uint32(0xFFFFFFFF)
+		if lim.HasMax {
+			max = lim.Max
+		}
+		fmt.Fprint(t.c, "  uint32_t offset;\n")
+		fmt.Fprintf(t.c, "  wasm_rt_allocate_table((&%s), %d, %du);\n", t.table, lim.Min, max)
+
+		for _, elem := range m.Elements {
+			offset, err := t.constExpr(elem.Offset)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(t.c, "  offset = %s;\n", offset)
+			for i, f := range elem.Funcs {
+				fmt.Fprintf(t.c, "  %s.data[offset + %d] = (wasm_rt_elem_t){%d, (wasm_rt_anyfunc_t)(%s)};\n", t.table, i, t.funcTypeID(f), t.funcPointer(f))
+			}
+		}
+	}
+	fmt.Fprint(t.c, "}\n\n")
+	return nil
+}
+
+func (t *translator) writeExports() error {
+	m := t.m
+	for _, exp := range m.Exports {
+		switch exp.Kind {
+		case wasm.KindFunc:
+			ty := m.FuncType(exp.Index)
+			name := prefixed(MangleExport(exp.Name, ty))
+			fmt.Fprintf(t.h, "\n/* export: '%s' */\nextern %s (*%s)(%s);\n", exp.Name, resultType(ty), name, paramTypes(ty))
+			fmt.Fprintf(t.c, "/* export: '%s' */\n%s (*%s)(%s);\n", exp.Name, resultType(ty), name, paramTypes(ty))
+		case wasm.KindMemory:
+			name := prefixed(MangleName(exp.Name))
+			fmt.Fprintf(t.h, "\n/* export: '%s' */\nextern wasm_rt_memory_t *%s;\n", exp.Name, name)
+			fmt.Fprintf(t.c, "/* export: '%s' */\nwasm_rt_memory_t *%s;\n", exp.Name, name)
+		case wasm.KindTable:
+			name := prefixed(MangleName(exp.Name))
+			fmt.Fprintf(t.h, "\n/* export: '%s' */\nextern wasm_rt_table_t *%s;\n", exp.Name, name)
+			fmt.Fprintf(t.c, "/* export: '%s' */\nwasm_rt_table_t *%s;\n", exp.Name, name)
+		case wasm.KindGlobal:
+			ty := m.Globals[exp.Index].Type.Type
+			name := prefixed(MangleName(exp.Name) + MangleName(typeChar(ty)))
+			fmt.Fprintf(t.h, "\n/* export: '%s' */\nextern %s *%s;\n", exp.Name, cType(ty), name)
+			fmt.Fprintf(t.c, "/* export: '%s' */\n%s *%s;\n", exp.Name, cType(ty), name)
+		}
+	}
+
+	fmt.Fprint(t.c, "\nstatic void init_exports(void) {\n")
+	for _, exp := range m.Exports {
+		switch exp.Kind {
+		case wasm.KindFunc:
+			fmt.Fprintf(t.c, "  %s = %s;\n", prefixed(MangleExport(exp.Name, m.FuncType(exp.Index))), t.funcPointer(exp.Index))
+		case wasm.KindMemory:
+			fmt.Fprintf(t.c, "  %s = (&%s);\n", prefixed(MangleName(exp.Name)), t.memory)
+		case wasm.KindTable:
+			fmt.Fprintf(t.c, "  %s = (&%s);\n", prefixed(MangleName(exp.Name)), t.table)
+		case wasm.KindGlobal:
+			ty := m.Globals[exp.Index].Type.Type
+			fmt.Fprintf(t.c, "  %s = (&%s);\n", prefixed(MangleName(exp.Name)+MangleName(typeChar(ty))), t.global(exp.Index))
+		}
+	}
+	fmt.Fprint(t.c, "}\n\n")
+	return nil
+}
+
+// prefixed adds the module prefix to an exported symbol, like wabt does. The
+// prefix is empty unless WASM_RT_MODULE_PREFIX is defined.
+func prefixed(name string) string {
+	return "WASM_RT_ADD_PREFIX(" + name + ")"
+}
+
+// constExpr translates a constant initializer expression.
+func (t *translator) constExpr(expr []byte) (string, error) {
+	instrs, err := wasm.Decode(expr)
+	if err != nil {
+		return "", err
+	}
+	if len(instrs) != 2 {
+		return "", errors.New("wasm2c: unsupported constant expression")
+	}
+
+	in := &instrs[0]
+	switch in.Op {
+	case wasm.OpI32Const:
+		return fmt.Sprintf("%du", uint32(in.Imm)), nil
+	case wasm.OpI64Const:
+		return fmt.Sprintf("%dull", in.Imm), nil
+	case wasm.OpF32Const:
+		return f32Const(in), nil
+	case wasm.OpF64Const:
+		return f64Const(in), nil
+	case wasm.OpGlobalGet:
+		return t.global(uint32(in.Imm)), nil
+	}
+	return "", errors.New("wasm2c: unsupported constant expression")
+}
+
+func (t *translator) funcTypeID(index uint32) uint32 {
+	if imp := t.m.ImportedFunc(index); imp != nil {
+		return t.typeIDs[imp.Type]
+	}
+	return t.typeIDs[t.m.Funcs[index-uint32(t.m.NumImportedFuncs())]]
+}
+
+// callee returns the C expression used to call a function.
+func (t *translator) callee(index uint32) string {
+	if imp := t.m.ImportedFunc(index); imp != nil {
+		return "(*" + MangleImport(imp.Module, imp.Name, t.m.Types[imp.Type]) + ")"
+	}
+	return t.funcName(index)
+}
+
+func (t *translator) funcPointer(index uint32) string {
+	if imp := t.m.ImportedFunc(index); imp != nil {
+		return MangleImport(imp.Module, imp.Name, t.m.Types[imp.Type])
+	}
+	return "(&" + t.funcName(index) + ")"
+}
+
+// global returns the C name of a global.
+func (t *translator) global(index uint32) string {
+	return fmt.Sprintf("%sg%d", t.prefix, index)
+}
+
+// funcName returns the C name of a function, in debug mode it includes the Go name.
+func (t *translator) funcName(index uint32) string {
+	name := fmt.Sprintf("%sw2c_f%d", t.prefix, index)
+	if n := t.m.FuncName(index); t.debug && n != "" {
+		name += "_" + strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return r
+			}
+			return '_'
+		}, n)
+	}
+	return name
+}
+
+func cType(t wasm.ValueType) string {
+	switch t {
+	case wasm.I32:
+		return "u32"
+	case wasm.I64:
+		return "u64"
+	case wasm.F32:
+		return "f32"
+	case wasm.F64:
+		return "f64"
+	}
+	return "void"
+}
+
+func resultType(ty wasm.FuncType) string {
+	if len(ty.Results) == 0 {
+		return "void"
+	}
+	return cType(ty.Results[0])
+}
+
+func paramTypes(ty wasm.FuncType) string {
+	if len(ty.Params) == 0 {
+		return "void"
+	}
+	var params []string
+	for _, p := range ty.Params {
+		params = append(params, cType(p))
+	}
+	return strings.Join(params, ", ")
+}
+
+func typeChar(t wasm.ValueType) string {
+	switch t {
+	case wasm.I32:
+		return "i"
+	case wasm.I64:
+		return "j"
+	case wasm.F32:
+		return "f"
+	case wasm.F64:
+		return "d"
+	}
+	return "v"
+}
+
+// DataBlob returns the content of the data segments, one after the other, as
+// embedded with DataIncbin.
+func DataBlob(m *wasm.Module) []byte {
+	var blob []byte
+	for _, data := range m.Data {
+		blob = append(blob, data.Bytes...)
+	}
+	return blob
+}
+
+// MangleName mangles a name the way wasm2c does, 'Z' is the escape character.
+func MangleName(name string) string {
+	var sb strings.Builder
+	sb.WriteString("Z_")
+	for _, c := range []byte(name) {
+		if ((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_') && c != 'Z' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "Z%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// MangleSignature returns the mangled result and parameter types of a function.
+func MangleSignature(ty wasm.FuncType) string {
+	sig := "v"
+	if len(ty.Results) > 0 {
+		sig = ""
+		for _, r := range ty.Results {
+			sig += typeChar(r)
+		}
+	}
+
+	if len(ty.Params) == 0 {
+		sig += "v"
+	}
+	for _, p := range ty.Params {
+		sig += typeChar(p)
+	}
+	return MangleName(sig)
+}
+
+// MangleImport returns the C symbol of an imported function.
+func MangleImport(module, name string, ty wasm.FuncType) string {
+	return MangleName(module) + MangleName(name) + MangleSignature(ty)
+}
+
+// MangleExport returns the C symbol of an exported function.
+func MangleExport(name string, ty wasm.FuncType) string {
+	return MangleName(name) + MangleSignature(ty)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package wasm2c
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gopherc/goc/cmd/goc/internal/ctest"
+	"github.com/gopherc/goc/cmd/goc/wasm"
+)
+
+// testModule returns a small module with an import, memory, table, global,
+// data segment and a call_indirect, like the ones the Go compiler writes.
+func testModule() *wasm.Module {
+	return &wasm.Module{
+		Types: []wasm.FuncType{
+			{Params: []wasm.ValueType{wasm.I32}},
+			{Results: []wasm.ValueType{wasm.I32}},
+			{Params: []wasm.ValueType{wasm.I32, wasm.I32}},
+		},
+		Imports:  []wasm.Import{{Module: "go", Name: "debug", Kind: wasm.KindFunc, Type: 0}},
+		Funcs:    []uint32{0, 2, 1},
+		Tables:   []wasm.Table{{ElemType: 0x70, Limits: wasm.Limits{Min: 2, Max: 2, HasMax: true}}},
+		Memories: []wasm.Memory{{Limits: wasm.Limits{Min: 1}}},
+		Globals: []wasm.Global{
+			{Type: wasm.GlobalType{Type: wasm.I32, Mutable: true}, Init: []byte{0x41, 0x80, 0x08, 0x0B}},
+		},
+		Exports: []wasm.Export{
+			{Name: "run", Kind: wasm.KindFunc, Index: 2},
+			{Name: "getsp", Kind: wasm.KindFunc, Index: 3},
+			{Name: "mem", Kind: wasm.KindMemory, Index: 0},
+		},
+		Elements: []wasm.Element{{Offset: []byte{0x41, 0x00, 0x0B}, Funcs: []uint32{1, 0}}},
+		Codes: []wasm.Code{
+			// i32.store offset=8 (local.get 0) (i32.const 7)
+			{Body: []byte{0x20, 0x00, 0x41, 0x07, 0x36, 0x02, 0x08, 0x0B}},
+			// call_indirect (type 0) (i32.const 8) (i32.const 0)
+			{Body: []byte{0x41, 0x08, 0x41, 0x00, 0x11, 0x00, 0x00, 0x0B}},
+			// i32.sub (global.get 0) (i32.const 1016)
+			{Body: []byte{0x23, 0x00, 0x41, 0xF8, 0x07, 0x6B, 0x0B}},
+		},
+		Data: []wasm.Data{{Offset: []byte{0x41, 0x80, 0x10, 0x0B}, Bytes: []byte{1, 2, 3}}},
+		Names: map[uint32]string{
+			1: "main.store",
+			2: "_rt0_wasm_js",
+			3: "runtime.getsp",
+		},
+	}
+}
+
+func TestTranslateUnits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wasm2c-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cFile := filepath.Join(dir, "out.c")
+	wasmFile := filepath.Join(dir, "out.wasm")
+	if err := wasm.WriteFile(wasmFile, testModule()); err != nil {
+		t.Fatal(err)
+	}
+	if err := TranslateFile(wasmFile, cFile, Options{Units: 3, Prefix: "pfx_"}); err != nil {
+		t.Fatal(err)
+	}
+
+	units := UnitFiles(cFile, 3)
+	if len(units) != 3 || filepath.Base(units[0]) != "out_shared.h" || filepath.Base(units[2]) != "out_2.c" {
+		t.Fatalf("unexpected unit files: %v", units)
+	}
+
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	shared := read(units[0])
+	for _, decl := range []string{
+		"extern W2C_HIDDEN wasm_rt_memory_t pfx_M0;",
+		"extern W2C_HIDDEN wasm_rt_table_t pfx_T0;",
+		"extern W2C_HIDDEN u32 pfx_g0;",
+		"W2C_HIDDEN void pfx_w2c_f1(u32);",
+		"W2C_HIDDEN u32 pfx_w2c_f3(void);",
+	} {
+		if !strings.Contains(shared, decl) {
+			t.Errorf("shared header is missing %q", decl)
+		}
+	}
+
+	// Every function is defined once, in some unit, and nothing shared is static.
+	defRegexp := regexp.MustCompile(`(?m)^(static )?W2C_HIDDEN \w+ (\w+)\(.*\) \{$|^static \w+ (w2c_f\d+)\(`)
+	defined := map[string]int{}
+	files := []string{cFile, units[1], units[2]}
+	for _, file := range files {
+		src := read(file)
+		if !strings.Contains(src, `#include "out_shared.h"`) {
+			t.Errorf("%s does not include the shared header", filepath.Base(file))
+		}
+		for _, m := range defRegexp.FindAllStringSubmatch(src, -1) {
+			if m[1] != "" || m[3] != "" {
+				t.Errorf("%s: shared function is static: %s", filepath.Base(file), m[0])
+			}
+			defined[m[2]]++
+		}
+	}
+	for _, name := range []string{"pfx_w2c_f1", "pfx_w2c_f2", "pfx_w2c_f3"} {
+		if defined[name] != 1 {
+			t.Errorf("%s is defined %d times", name, defined[name])
+		}
+	}
+	if !strings.Contains(read(cFile), "\nW2C_HIDDEN u32 pfx_g0;\n") {
+		t.Error("the module state is not defined in the first unit")
+	}
+
+	ctest.Compile(t, dir, files...)
+}
+
+func TestTranslateSingleUnitIsStatic(t *testing.T) {
+	var c, h strings.Builder
+	if err := Translate(testModule(), &c, &h, "out.h", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	src := c.String()
+	for _, decl := range []string{"static u32 g0;", "static wasm_rt_memory_t M0;", "static void w2c_f1(u32 l0) {"} {
+		if !strings.Contains(src, decl) {
+			t.Errorf("missing %q", decl)
+		}
+	}
+	if strings.Contains(src, "W2C_HIDDEN") {
+		t.Error("single unit output uses shared symbols")
+	}
+
+	if err := Translate(testModule(), &c, &h, "out.h", Options{Units: 2}); err == nil {
+		t.Error("Translate accepted more than one unit")
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	tests := []struct {
+		line      int
+		fileDirty bool
+		want      string
+	}{
+		{0, true, ""},
+		{-1, true, ""},
+		{-1, false, ""},
+		{12, false, "#line 12\n"},
+		{12, true, "#line 12 \"C:\\\\go\\\\\\\"x\\\".go\"\n"},
+	}
+	for _, test := range tests {
+		f := &function{lines: &funcLines{file: `C:\go\"x".go`, line: test.line, fileDirty: test.fileDirty}}
+		f.writeLine()
+		if got := f.sb.String(); got != test.want {
+			t.Errorf("line %d: got %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestResumePoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		starts []int
+		n      int
+		outer  int
+	}{
+		{
+			// block, loop, 3 x block, global.get 1, br_table 0 1 1 2
+			name:   "loop",
+			body:   []byte{0x02, 0x40, 0x03, 0x40, 0x02, 0x40, 0x02, 0x40, 0x02, 0x40, 0x23, 0x01, 0x0E, 0x03, 0x00, 0x01, 0x01, 0x02, 0x0B, 0x0B, 0x0B, 0x0B, 0x0B, 0x0B},
+			starts: []int{0, 1, -1},
+			n:      7,
+			outer:  2,
+		},
+		{
+			// global.get 0, local.set 1, 4 x block, local.get 0, br_table 0 0 1 2
+			name:   "SP in a local",
+			body:   []byte{0x23, 0x00, 0x21, 0x01, 0x02, 0x40, 0x02, 0x40, 0x02, 0x40, 0x02, 0x40, 0x20, 0x00, 0x0E, 0x03, 0x00, 0x00, 0x01, 0x02, 0x0B, 0x0B, 0x0B, 0x0B, 0x0B},
+			starts: []int{0, 2, -1},
+			n:      8,
+			outer:  1,
+		},
+		{
+			// block, i32.const 0, br_if 0, end
+			name: "not resumable",
+			body: []byte{0x02, 0x40, 0x41, 0x00, 0x0D, 0x00, 0x0B, 0x0B},
+		},
+	}
+
+	for _, test := range tests {
+		instrs, err := wasm.Decode(test.body)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		starts, n, outer := resumePoints(instrs)
+		if !reflect.DeepEqual(starts, test.starts) || n != test.n || outer != test.outer {
+			t.Errorf("%s: got %v %d %d, want %v %d %d", test.name, starts, n, outer, test.starts, test.n, test.outer)
+		}
+	}
+}
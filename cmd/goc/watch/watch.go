@@ -0,0 +1,215 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+// Package watch reruns a build when the Go sources or the binding files of a project change.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExitInterrupted is the exit status of a watch that was stopped, it follows the conventions of the shells.
+const ExitInterrupted = 130
+
+// Interval is how often the files are checked for changes.
+var Interval = 500 * time.Millisecond
+
+// Sources matches the files a build depends on, the Go sources and the
+// binding files. The generated bind_goc.go is not included.
+func Sources(name string) bool {
+	switch name {
+	case "goc.bind", "goc.type", "helper_goc.c":
+		return true
+	case "bind_goc.go":
+		return false
+	}
+	return strings.HasSuffix(name, ".go")
+}
+
+// Bindings matches the files the C bindings are generated from.
+func Bindings(name string) bool {
+	return name == "goc.bind" || name == "goc.type"
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+type Watcher struct {
+	roots []string
+	match func(name string) bool
+	files map[string]fileState
+}
+
+// New returns a watcher for the files under roots with names accepted by match.
+func New(match func(name string) bool, roots ...string) *Watcher {
+	w := &Watcher{match: match}
+	seen := map[string]bool{}
+	for _, root := range roots {
+		if root, err := filepath.Abs(root); err == nil && !seen[root] {
+			seen[root] = true
+			w.roots = append(w.roots, root)
+		}
+	}
+	w.files = w.scan()
+	return w
+}
+
+// Len returns the number of watched files.
+func (w *Watcher) Len() int {
+	return len(w.files)
+}
+
+// scan walks the roots, skipping directories the go tool ignores.
+func (w *Watcher) scan() map[string]fileState {
+	files := map[string]fileState{}
+	for _, root := range w.roots {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			name := info.Name()
+			if info.IsDir() {
+				if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if w.match(name) {
+				files[path] = fileState{info.ModTime(), info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// Wait blocks until files are added, removed or modified and returns them.
+// It returns nil if ctx is cancelled first.
+func (w *Watcher) Wait(ctx context.Context) []string {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(Interval):
+		}
+		files := w.scan()
+		changed := diff(w.files, files)
+		if len(changed) == 0 {
+			continue
+		}
+
+		// Editors and code generators often write in several steps, wait for it to settle.
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(Interval):
+			}
+			next := w.scan()
+			if len(diff(files, next)) == 0 {
+				break
+			}
+			files = next
+		}
+
+		changed = diff(w.files, files)
+		w.files = files
+		if len(changed) > 0 {
+			return changed
+		}
+	}
+}
+
+func diff(old, files map[string]fileState) []string {
+	var changed []string
+	for path, st := range files {
+		if o, ok := old[path]; !ok || o != st {
+			changed = append(changed, path)
+		}
+	}
+	for path := range old {
+		if _, ok := files[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Run calls build at once and then every time the matched files changes,
+// with the files that changed. It prints a one line summary of each build
+// to stderr, the build output itself is left to build. Run returns
+// ExitInterrupted when ctx is cancelled.
+func Run(ctx context.Context, name string, roots []string, match func(name string) bool, build func(changed []string) bool) int {
+	w := New(match, roots...)
+	fmt.Fprintf(os.Stderr, "Watching %d files, press Ctrl+C to stop.\n", w.Len())
+
+	var changed []string
+	for {
+		start := time.Now()
+		status := "ok  "
+		if !build(changed) {
+			status = "FAIL"
+		}
+		fmt.Fprintf(os.Stderr, "%s\t%s\t%s\t%.1fs\t%s\n", status, start.Format("15:04:05"), name, time.Since(start).Seconds(), describe(changed))
+
+		if changed = w.Wait(ctx); changed == nil {
+			return ExitInterrupted
+		}
+	}
+}
+
+// Interrupted returns a context that is cancelled on the first interrupt or
+// termination signal, a second one kills the process directly. The returned
+// function restores the default signal handling.
+func Interrupted() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sig:
+			signal.Stop(sig)
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sig)
+		close(done)
+		cancel()
+	}
+}
+
+// describe summarizes the changed files, like 'main.go, goc.bind and 3 more'.
+func describe(changed []string) string {
+	if len(changed) == 0 {
+		return "initial run"
+	}
+
+	const max = 3
+	var names []string
+	for i, path := range changed {
+		if i == max {
+			return fmt.Sprintf("%s and %d more", strings.Join(names, ", "), len(changed)-max)
+		}
+		names = append(names, filepath.Base(path))
+	}
+	return strings.Join(names, ", ")
+}
@@ -47,6 +47,19 @@ extern void *GOC_ALLOC(void*, size_t);
     #define GOC_ENTRY main
 #endif
 
+/* The exports of the module are prefixed with WASM_RT_MODULE_PREFIX, like in the wasm2c header. */
+#ifndef WASM_RT_MODULE_PREFIX
+    #define WASM_RT_MODULE_PREFIX
+#endif
+#define WASM_RT_PASTE_(x, y) x ## y
+#define WASM_RT_PASTE(x, y) WASM_RT_PASTE_(x, y)
+#define WASM_RT_ADD_PREFIX(x) WASM_RT_PASTE(WASM_RT_MODULE_PREFIX, x)
+
+#define Z_runZ_vii WASM_RT_ADD_PREFIX(Z_runZ_vii)
+#define Z_resumeZ_vv WASM_RT_ADD_PREFIX(Z_resumeZ_vv)
+#define Z_getspZ_iv WASM_RT_ADD_PREFIX(Z_getspZ_iv)
+#define Z_mem WASM_RT_ADD_PREFIX(Z_mem)
+
 #define MAX_ARGC 256
 #define PAGE_SIZE 65536
 
@@ -60,8 +73,8 @@ extern void *GOC_ALLOC(void*, size_t);
 
 #define NOTIMPL(name) IMPL(name) { (void)sp; panic("not implemented: " #name); }
 
-int32_t exit_code = -1;
-int32_t has_exit = 0;
+static int32_t exit_code = -1;
+static int32_t has_exit = 0;
 
 /* export: 'run' */
 extern void (*Z_runZ_vii)(uint32_t, uint32_t);
@@ -241,16 +254,16 @@ static int write_string(int *offset, const char *str) {
     return p;
 }
 
-extern void init();
+extern void WASM_RT_ADD_PREFIX(init)();
 
-int pointerOffsets[MAX_ARGC] = {0};
+static int pointerOffsets[MAX_ARGC] = {0};
 
 EXPORT int GOC_ENTRY(int argc, char *argv[]) {
     if (argc > MAX_ARGC)
         argc = MAX_ARGC;
     
     srand((unsigned)time(NULL));
-    init();
+    WASM_RT_ADD_PREFIX(init)();
 
     /* Pass command line arguments and environment variables by writing them to the linear memory. */
 	int offset = 4096;
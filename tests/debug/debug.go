@@ -0,0 +1,20 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package main
+
+import "fmt"
+
+//go:noinline
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func main() {
+	total := sum([]int{1, 2, 3, 4}) // The tester looks for a #line directive of this line.
+	fmt.Println("debug:", total)
+}
@@ -0,0 +1,3 @@
+module github.com/gopherc/goc/tests/debug
+
+go 1.12
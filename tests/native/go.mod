@@ -0,0 +1,3 @@
+module github.com/gopherc/goc/tests/native
+
+go 1.12
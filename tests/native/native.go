@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The program covers the instructions the translator has to get right, its
+// output is compared with the output of the program built by Go.
+
+type shape interface {
+	area() float64
+}
+
+type rect struct{ w, h float64 }
+type circle struct{ r float64 }
+
+func (r rect) area() float64   { return r.w * r.h }
+func (c circle) area() float64 { return math.Pi * c.r * c.r }
+
+func integers() {
+	var a, b int64 = math.MaxInt64, -3
+	var u uint32 = 0xFFFFFFFF
+	fmt.Println(a/b, a%b, a>>7, uint64(a)<<3, u+1, u>>31, int8(u), -7/2, -7%2)
+	fmt.Println(bitsSum(0xF0F0F0F0F0F0F0F0), uint32(1)<<(u&31))
+}
+
+func bitsSum(x uint64) (n int) {
+	for ; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
+
+func floats() {
+	x, y, z := 1.5, math.Copysign(0, -1), -2.9
+	fmt.Println(math.Sqrt(2), math.Floor(-x), math.Trunc(-x), math.Copysign(3, y), math.Inf(1) > math.MaxFloat64)
+	fmt.Println(math.IsNaN(math.NaN()), float32(1)/3, int64(z), uint8(-z*70), math.Float64bits(x))
+}
+
+func indirect() {
+	shapes := []shape{rect{2, 3}, circle{1}, rect{0.5, 4}}
+	sort.Slice(shapes, func(i, j int) bool { return shapes[i].area() < shapes[j].area() })
+
+	var sum float64
+	for _, s := range shapes {
+		sum += s.area()
+	}
+	fmt.Printf("%.4f %T\n", sum, shapes[0])
+
+	counter := func() func() int {
+		n := 0
+		return func() int { n++; return n }
+	}()
+	counter()
+	fmt.Println(counter())
+}
+
+func recovers() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered: %v", r)
+		}
+	}()
+	var m map[string]int
+	m["x"] = 1
+	return errors.New("unreachable")
+}
+
+func channels() {
+	results := make(chan int)
+	for i := 1; i <= 4; i++ {
+		go func(n int) {
+			sum := 0
+			for j := 0; j < n*1000; j++ {
+				sum += j % 7
+			}
+			results <- sum
+		}(i)
+	}
+
+	total := 0
+	for i := 0; i < 4; i++ {
+		total += <-results
+	}
+	fmt.Println(total)
+}
+
+func collections() {
+	words := strings.Fields("the quick brown fox jumps over the lazy dog the end")
+	count := map[string]int{}
+	for _, w := range words {
+		count[w]++
+	}
+
+	var keys []string
+	for k := range count {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[:3] {
+		fmt.Print(k, "=", count[k], " ")
+	}
+	fmt.Println(len(count), strings.ToUpper(words[1]))
+}
+
+func main() {
+	integers()
+	floats()
+	indirect()
+	fmt.Println(recovers())
+	channels()
+	collections()
+}
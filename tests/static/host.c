@@ -0,0 +1,14 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+#include <stdio.h>
+
+#include "libstatic.h"
+
+// The host owns main and runs the Go program through the library entry point.
+int main(int argc, char *argv[]) {
+    printf("host\n");
+    int ret = goc_main(argc, argv);
+    printf("exit: %d\n", ret);
+    return 0;
+}
@@ -0,0 +1,14 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("static:", os.Args[1:])
+	os.Exit(3)
+}
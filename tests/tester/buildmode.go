@@ -0,0 +1,194 @@
+// Copyright (c) 2016-2019, Andreas T Jonsson
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// The build mode tests run in the directory of the test program, goc is
+// found relative to it like in runTest.
+const gocPath = "../../cmd/goc/goc"
+
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+func check(err error) {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+}
+
+// checkOutput runs prog in wd and compares what it writes to stdout with want.
+func checkOutput(prog, wd, want string, args ...string) error {
+	cmd := exec.Command(prog, args...)
+	cmd.Dir = wd
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("%s: %v\n%s", prog, err, ee.Stderr)
+	} else if err != nil {
+		return err
+	}
+
+	if string(out) != want {
+		return fmt.Errorf("%s: got %q, want %q", prog, out, want)
+	}
+	return nil
+}
+
+func cCompiler() string {
+	if cc := os.Getenv("CC"); cc != "" {
+		return cc
+	}
+	return "cc"
+}
+
+// testStatic links the program as a static library into a C host that has its own main.
+func testStatic(dir string) error {
+	host := "host" + exeSuffix()
+	defer func() {
+		for _, file := range []string{"libstatic.a", "libstatic.h", host} {
+			os.Remove(filepath.Join(dir, file))
+		}
+	}()
+
+	if err := runProgram(gocPath+exeSuffix(), dir, nil, "build", "-buildmode", "static", "-o", "libstatic.a", "static.go"); err != nil {
+		return err
+	}
+	if err := runProgram(cCompiler(), dir, nil, "-o", host, "host.c", "libstatic.a", "-lm"); err != nil {
+		return err
+	}
+
+	if err := checkOutput("./"+host, dir, "host\nstatic: [a b]\nexit: 3\n", "a", "b"); err != nil {
+		return err
+	}
+	fmt.Println("[goc static]", "static.go: ok")
+	return nil
+}
+
+// testCSource writes the program as C sources and builds them with the generated Makefile.
+func testCSource(dir string) error {
+	const src = "csource_src"
+	defer os.RemoveAll(filepath.Join(dir, src))
+
+	if err := runProgram(gocPath+exeSuffix(), dir, nil, "build", "-buildmode", "c-source", "-o", src, "csource.go"); err != nil {
+		return err
+	}
+
+	make := os.Getenv("MAKE")
+	if make == "" {
+		make = "make"
+	}
+	if err := runProgram(make, filepath.Join(dir, src), nil, "CC="+cCompiler()); err != nil {
+		return err
+	}
+
+	// The Makefile names the program after the output directory.
+	if err := checkOutput("./"+src+exeSuffix(), filepath.Join(dir, src), "c-source: gogogo\n"); err != nil {
+		return err
+	}
+	fmt.Println("[goc c-source]", "csource.go: ok")
+	return nil
+}
+
+// testNative builds the program with the native translator in several
+// translation units and compares its output with the program built by Go.
+func testNative(dir string) error {
+	goOutput, gocOutput := "go_native"+exeSuffix(), "goc_native"+exeSuffix()
+	defer os.Remove(filepath.Join(dir, goOutput))
+	defer os.Remove(filepath.Join(dir, gocOutput))
+
+	if err := runProgram("../../go/bin/go"+exeSuffix(), dir, nil, "build", "-o", goOutput, "native.go"); err != nil {
+		return err
+	}
+	cmd := exec.Command("./" + goOutput)
+	cmd.Dir = dir
+	want, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	if err := runProgram(gocPath+exeSuffix(), dir, nil, "build", "-translator", "native", "-j", "4", "-o", gocOutput, "native.go"); err != nil {
+		return err
+	}
+	if err := checkOutput("./"+gocOutput, dir, string(want)); err != nil {
+		return err
+	}
+	fmt.Println("[goc native]", "native.go: ok")
+	return nil
+}
+
+// testDebug builds the program with -debug and checks that the generated C
+// code is mapped to the line in the Go source that calls sum.
+func testDebug(dir string) error {
+	work, err := ioutil.TempDir("", "goc-debug")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+
+	output := "goc_debug" + exeSuffix()
+	defer os.Remove(filepath.Join(dir, output))
+	if err := runProgram(gocPath+exeSuffix(), dir, nil, "build", "-debug", "-work", work, "-o", output, "debug.go"); err != nil {
+		return err
+	}
+	if err := checkOutput("./"+output, dir, "debug: 10\n"); err != nil {
+		return err
+	}
+
+	src, err := ioutil.ReadFile(filepath.Join(dir, "debug.go"))
+	if err != nil {
+		return err
+	}
+	line := 1 + bytes.Count(src[:bytes.Index(src, []byte("sum([]int{"))], []byte("\n"))
+
+	c, err := ioutil.ReadFile(filepath.Join(work, "out.c"))
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !hasLineDirective(c, filepath.Base(abs)+"/debug.go", line) {
+		return fmt.Errorf("debug.go: no #line directive for line %d", line)
+	}
+	fmt.Println("[goc -debug]", "debug.go: ok")
+	return nil
+}
+
+var lineRegexp = regexp.MustCompile(`^#line (\d+)(?: "(.*)")?$`)
+
+// hasLineDirective reports if c has a #line directive for line in a file
+// that ends with name, the file is only written when it changes.
+func hasLineDirective(c []byte, name string, line int) bool {
+	var current string
+	for _, l := range strings.Split(string(c), "\n") {
+		m := lineRegexp.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		if m[2] != "" {
+			current = filepath.ToSlash(strings.Replace(m[2], `\\`, `\`, -1))
+		}
+		if m[1] == strconv.Itoa(line) && strings.HasSuffix(current, "/"+name) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"bytes"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -21,7 +22,12 @@ const (
 	conformance = false
 )
 
+// The build mode tests need a C compiler and make in addition to Go, they can
+// be skipped with -buildmodes=false where those are missing.
+var buildmodes = flag.Bool("buildmodes", true, "test the static, c-source, native and debug build modes")
+
 func main() {
+	flag.Parse()
 	//os.Setenv("CC", "clang")
 
 	knucleotide, err := ioutil.ReadFile("k-nucleotide-input.txt")
@@ -37,6 +43,13 @@ func main() {
 		test("../bind/bind.go", nil)
 	}
 
+	if *buildmodes {
+		check(testStatic("../static"))
+		check(testCSource("../csource"))
+		check(testNative("../native"))
+		check(testDebug("../debug"))
+	}
+
 	if benchmark {
 		test("../garbage/garbage.go", nil, "20000000")
 		test("../mandelbrot/mandelbrot.go", nil, "16000")